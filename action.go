@@ -1,30 +1,35 @@
 package minidb
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"github.com/injoyai/conv"
+	"github.com/injoyai/minidb/builder"
 	"github.com/injoyai/minidb/core"
 	"os"
+	"reflect"
+	"sort"
 	"strings"
 )
 
 func NewAction(db *DB) *Action {
 	return &Action{
-		db:      db,
-		scanner: core.NewFile("", 0),
+		db:       db,
+		scanner:  core.NewFile("", 0),
+		patterns: patterns{},
 	}
 }
 
 /*
 Action
-暂不支持or
+多次调用Where/And为and关系
 */
 type Action struct {
 	db *DB
 
-	Handler      []func(field map[string]*Field) (mate bool, err error) //筛选添加,例where and 暂未实现 or
-	LimitHandler func(index int, field map[string]string) (done bool)   //对应操作Limit
+	Handler      []func(field map[string]*Field) (mate bool, err error) //筛选条件,例where
+	LimitHandler func(index int, field map[string]string) (done bool)   //Deprecated: 不再使用,分页见Limit
 	SortHandler  func(i, j map[string]*Field) bool                      //对应操作Sort
 	Result       []interface{}                                          //对应Find和FindAndCount的数据缓存
 	Err          error                                                  //操作的错误信息
@@ -32,6 +37,27 @@ type Action struct {
 	TableName string     //要操作的表名
 	scanner   *core.File //文件操作
 	table     *Table     //要操作的表信息
+	limited   bool       //是否设置了分页
+	limit     int        //分页大小
+	offset    int        //分页偏移,符合条件的数据数量
+	after     int64      //按主键分页,主键大于该值
+	ids       []int64    //按主键查询,从小到大,例 ID(id)
+	total     *int64     //不为nil时统计符合条件的总数量,分页后继续遍历
+	joins     []*join    //关联的表
+	joined    *Table     //关联查询时全部关联表的表头
+	sets      []*setExpr //修改时按表达式计算的字段,例 Incr
+	cols      []string   //查询或修改的字段,为空时全部字段
+	mustCols  []string   //修改时零值也需要修改的字段
+	omit      []string   //查询或修改时排除的字段
+	allCols   bool       //修改时全部字段都修改,包括零值
+	distinct  []string   //去重的字段,在筛选条件之后
+	locked    bool       //表已经锁定,例事务提交时
+
+	groups     []string                                               //分组字段
+	aggregates []*aggregate                                           //聚合字段,例 sum(bytes) as total
+	having     []func(field map[string]*Field) (mate bool, err error) //分组后的筛选条件
+	checks     []func(t *Table) error                                 //读取表信息后,操作数据前的校验,例字段是否存在
+	patterns   patterns                                               //like和regexp的编译缓存
 }
 
 func (this *Action) Table(table interface{}) *Action {
@@ -39,112 +65,284 @@ func (this *Action) Table(table interface{}) *Action {
 	return this
 }
 
-func (this *Action) Where(s string, args ...interface{}) *Action {
-	offset := 0
-	for _, v := range strings.Split(s, " and ") {
-		typeList := []string{" like ", "<>", "!=", ">=", ">", "<=", "<", "="}
-		for _, Type := range typeList {
-			if ls := strings.SplitN(v, Type, 2); len(ls) == 2 {
-				key := strings.TrimSpace(ls[0])
-				value := strings.TrimSpace(ls[1])
-				if value == "?" {
-					if len(args) > offset {
-						value = conv.String(args[offset])
-						offset++
-					} else {
-						this.Err = fmt.Errorf("缺少参数(%s)", v)
-						return this
-					}
-				}
-				this.Handler = append(this.Handler, func(field map[string]*Field) (bool, error) {
-					val, ok := field[key]
-					if !ok {
-						return false, fmt.Errorf("字段(%s)不存在", key)
-					}
-					return val.compare(Type, value), nil
-				})
-				break
-			}
+// Where 筛选条件,支持and,or,not及括号,例 Where("(age>? and boy=?) or name=?",18,true,"小米")
+// 也可以是条件构造(builder.Cond),例 Where(builder.Or(builder.Eq("name","小米"),builder.Gt("age",18)))
+// 或者结构体(非零字段)和map,生成等于条件,例 Where(map[string]interface{}{"name":"小米"})
+func (this *Action) Where(query interface{}, args ...interface{}) *Action {
+	if this.Err != nil {
+		return this
+	}
+	switch val := query.(type) {
+	case string:
+		return this.where(val, args...)
+	case interface {
+		ToSQL() (string, []interface{}, error)
+	}:
+		s, args, err := val.ToSQL()
+		if err != nil {
+			this.Err = err
+			return this
 		}
+		return this.where(s, args...)
+	default:
+		return this.whereBean(query)
+	}
+}
 
+// whereBean 按对象生成等于条件,结构体为非零的字段,map为全部字段,例 Where(&Person{Name:"小米"})
+func (this *Action) whereBean(bean interface{}) *Action {
+	m := make(map[string]interface{})
+	switch reflect.Indirect(reflect.ValueOf(bean)).Kind() {
+	case reflect.Map:
+		if err := this.db.unmarshal(bean, &m); err != nil {
+			this.Err = err
+			return this
+		}
+	case reflect.Struct:
+		if err := this.db.unmarshal(bean, &m); err != nil {
+			this.Err = err
+			return this
+		}
+		m = nonZero(m)
+	default:
+		this.Err = fmt.Errorf("未知的条件类型: %T", bean)
+		return this
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	conds := make([]builder.Cond, 0, len(keys))
+	for _, k := range keys {
+		conds = append(conds, builder.Eq(k, m[k]))
 	}
+	return this.Where(builder.And(conds...))
+}
+
+func (this *Action) And(query interface{}, args ...interface{}) *Action {
+	return this.Where(query, args...)
+}
+
+// where 解析条件语句,增加到筛选条件
+func (this *Action) where(s string, args ...interface{}) *Action {
+	if len(strings.TrimSpace(s)) == 0 {
+		return this
+	}
+	c, err := parseWhere(this.patterns, s, args...)
+	if err != nil {
+		this.Err = err
+		return this
+	}
+	this.Handler = append(this.Handler, c.mate)
+	this.checks = append(this.checks, func(t *Table) error { return checkKeys(c, t) })
 	return this
 }
 
-func (this *Action) And(s string, args ...interface{}) *Action {
-	return this.Where(s, args...)
+// nonZero 去掉零值的字段
+func nonZero(m map[string]interface{}) map[string]interface{} {
+	for k, v := range m {
+		if v == nil || reflect.ValueOf(v).IsZero() {
+			delete(m, k)
+		}
+	}
+	return m
+}
+
+// WhereFunc 自定义筛选条件,例 WhereFunc(func(row map[string]*Field) bool { return check(row["data"].Value) })
+func (this *Action) WhereFunc(fn func(row map[string]*Field) bool) *Action {
+	this.Handler = append(this.Handler, func(field map[string]*Field) (bool, error) {
+		return fn(field), nil
+	})
+	return this
 }
 
+// WhereBean 自定义筛选条件,每条数据解析到新的bean中再判断,
+// 例 WhereBean(new(Person), func(bean interface{}) bool { return bean.(*Person).Age > 18 })
+func (this *Action) WhereBean(bean interface{}, fn func(bean interface{}) bool) *Action {
+	t := reflect.TypeOf(bean)
+	if t == nil || t.Kind() != reflect.Ptr {
+		this.Err = errors.New("bean需要是指针")
+		return this
+	}
+	this.Handler = append(this.Handler, func(field map[string]*Field) (bool, error) {
+		v := reflect.New(t.Elem()).Interface()
+		if err := this.db.unmarshal(fieldString(field), v); err != nil {
+			return false, err
+		}
+		return fn(v), nil
+	})
+	return this
+}
+
+// Like 模糊查询,字段的值包含like,需要通配符时使用 Where("name like ?","小%")
 func (this *Action) Like(filed, like string) *Action {
-	return this.Where(fmt.Sprintf("%s like %s", filed, like))
+	return this.Where(filed+" like ?", "%"+escapeLike(like)+"%")
 }
 
+// Cols 需要的字段,可以是聚合字段,例 Cols("level,count(*),sum(bytes) as total")
+// 修改时只修改这些字段,零值也修改
 func (this *Action) Cols(cols ...string) *Action {
-	m := make(map[string]bool)
+	for _, v := range splitCols(cols) {
+		if agg := parseAggregate(v); agg != nil {
+			this.aggregates = append(this.aggregates, agg)
+			this.checks = append(this.checks, agg.check)
+			continue
+		}
+		this.cols = append(this.cols, v)
+	}
+	return this
+}
+
+// AllCols 修改时全部字段都修改,包括零值
+func (this *Action) AllCols() *Action {
+	this.allCols = true
+	return this
+}
+
+// MustCols 修改时这些字段为零值也修改,其他字段默认不修改零值
+func (this *Action) MustCols(cols ...string) *Action {
+	this.mustCols = append(this.mustCols, splitCols(cols)...)
+	return this
+}
+
+// Omit 查询或修改时排除这些字段
+func (this *Action) Omit(cols ...string) *Action {
+	this.omit = append(this.omit, splitCols(cols)...)
+	return this
+}
+
+// splitCols 拆分逗号分隔的字段,例 "name,age"
+func splitCols(cols []string) (ls []string) {
 	for _, s := range cols {
 		for _, v := range strings.Split(s, ",") {
-			if len(v) > 0 {
-				m[v] = true
+			if v = strings.TrimSpace(v); len(v) > 0 {
+				ls = append(ls, v)
 			}
 		}
 	}
-	//当调用了Cols而未设置值是,视为无效
-	if len(m) == 0 {
-		return this
+	return
+}
+
+// project 按Cols和Omit保留查询结果的字段,分组查询时结果为分组字段及聚合字段
+func (this *Action) project(field map[string]*Field) map[string]*Field {
+	if this.grouped() || (len(this.cols) == 0 && len(this.omit) == 0) {
+		return field
 	}
-	this.Handler = append(this.Handler, func(field map[string]*Field) (next bool, err error) {
-		for k, _ := range field {
-			if !m[k] {
-				delete(field, k)
-			}
+	result := make(map[string]*Field, len(field))
+	for k, v := range field {
+		if (len(this.cols) == 0 || inCols(this.cols, k)) && !inCols(this.omit, k) {
+			result[k] = v
 		}
-		return true, nil
-	})
-	return this
+	}
+	return result
 }
 
-func (this *Action) Limit(size int, offset ...int) *Action {
-	this.LimitHandler = func(index int, field map[string]string) bool {
-		if len(offset) > 0 && index < offset[0] {
-			return false
+// updateCols 修改时保留需要修改的字段,默认结构体的零值字段不修改,map全部修改
+func (this *Action) updateCols(i interface{}, update map[string]interface{}) map[string]interface{} {
+	isStruct := reflect.Indirect(reflect.ValueOf(i)).Kind() == reflect.Struct
+	for k, v := range update {
+		switch {
+		case inCols(this.omit, k):
+		case len(this.cols) > 0:
+			if inCols(this.cols, k) {
+				continue
+			}
+		case this.allCols || !isStruct || inCols(this.mustCols, k):
+			continue
+		case v != nil && !reflect.ValueOf(v).IsZero():
+			continue
 		}
-		if size == 0 {
+		delete(update, k)
+	}
+	return update
+}
+
+func inCols(cols []string, col string) bool {
+	for _, v := range cols {
+		if v == col {
 			return true
 		}
-		this.Result = append(this.Result, field)
-		return len(this.Result) >= size && size > 0
 	}
+	return false
+}
+
+// Limit 分页,offset为跳过符合条件的数据数量,size小于0时不限制数量
+func (this *Action) Limit(size int, offset ...int) *Action {
+	this.limit = size
+	this.offset = 0
+	if len(offset) > 0 {
+		this.offset = offset[0]
+	}
+	this.limited = true
 	return this
 }
 
-// Desc 倒序,未实现
+// paging 分页,index为符合条件的数据的序号,返回是否在分页内,及后续是否还有分页内的数据
+func (this *Action) paging(index int) (in bool, next bool) {
+	if !this.limited || this.limit < 0 {
+		return index >= this.offset, true
+	}
+	end := this.offset + this.limit
+	return index >= this.offset && index < end, index+1 < end
+}
+
+// ID 按主键查询,修改或删除,主键有序时二分查找定位到最小的主键,超过最大的主键后结束遍历,否则遍历全部数据,
+// 例 ID(job.ID).Get(&job) ,ID(1,2,3).Delete(new(Job))
+func (this *Action) ID(ids ...interface{}) *Action {
+	if this.Err != nil {
+		return this
+	}
+	if len(ids) == 0 {
+		this.Err = errors.New("主键不能为空")
+		return this
+	}
+	for _, v := range ids {
+		this.ids = append(this.ids, conv.Int64(v))
+	}
+	sort.Slice(this.ids, func(i, j int) bool { return this.ids[i] < this.ids[j] })
+	return this.where(this.db.id+" in ?", this.ids)
+}
+
+// After 按主键分页,查询主键大于id的数据,主键按时间递增,通过二分查找定位,不用从头遍历,
+// 例 After(last.ID).Limit(10) ,last为上一页的最后一条数据
+func (this *Action) After(id int64) *Action {
+	this.after = id
+	return this.where(this.db.id+" > ?", id)
+}
+
+// Desc 倒序,可多次调用,例 Asc("age").Desc("time")
 func (this *Action) Desc(filed string) *Action {
-	this.SortHandler = func(i, j map[string]*Field) bool {
+	this.checks = append(this.checks, this.checkSort(filed))
+	return this.sortBy(func(i, j map[string]*Field) bool {
 		f1 := i[filed]
 		f2 := j[filed]
 		if f1 == nil || f2 == nil {
 			return false
 		}
 		return f1.compare(">", f2.Value)
-	}
-	return this
+	})
 }
 
-// Asc 正序,取最小的字段,未实现
+// Asc 正序,可多次调用,例 Asc("age").Desc("time")
 func (this *Action) Asc(filed string) *Action {
-	this.SortHandler = func(i, j map[string]*Field) bool {
+	this.checks = append(this.checks, this.checkSort(filed))
+	return this.sortBy(func(i, j map[string]*Field) bool {
 		f1 := i[filed]
 		f2 := j[filed]
 		if f1 == nil || f2 == nil {
 			return false
 		}
 		return f1.compare("<", f2.Value)
-	}
-	return this
+	})
 }
 
-func (this *Action) Get(i interface{}) (has bool, err error) {
+// Get 查找一条数据,conds为条件对象,同Where,例 Get(&p, &Person{Name:"小米"})
+func (this *Action) Get(i interface{}, conds ...interface{}) (has bool, err error) {
 	defer this.dealErr(&err)
+	for _, v := range conds {
+		this.Where(v)
+	}
 	if err := this.setTable(i); err != nil {
 		return false, err
 	}
@@ -159,8 +357,12 @@ func (this *Action) Get(i interface{}) (has bool, err error) {
 	return true, err
 }
 
-func (this *Action) Find(i interface{}) (err error) {
+// Find 查找数据,conds为条件对象,同Where,例 Find(&list, &Person{Name:"小米",Age:18})
+func (this *Action) Find(i interface{}, conds ...interface{}) (err error) {
 	defer this.dealErr(&err)
+	for _, v := range conds {
+		this.Where(v)
+	}
 	if err := this.setTable(i); err != nil {
 		return err
 	}
@@ -184,12 +386,8 @@ func (this *Action) FindAndCount(i interface{}) (co int64, err error) {
 	if err := this.setTable(i); err != nil {
 		return 0, err
 	}
-	//统计数量
-	co, err = this.count()
-	if err != nil {
-		return 0, err
-	}
-	//查找数据
+	//查找数据,同时统计数量
+	this.total = &co
 	if err = this.find(); err != nil {
 		return 0, err
 	}
@@ -197,14 +395,74 @@ func (this *Action) FindAndCount(i interface{}) (co int64, err error) {
 	return co, this.db.unmarshal(this.Result, i)
 }
 
+// Exist 是否存在符合条件的数据,找到第一条后停止
+func (this *Action) Exist(i ...interface{}) (has bool, err error) {
+	defer this.dealErr(&err)
+	if err := this.setTable(i...); err != nil {
+		return false, err
+	}
+	err = this.rangeResult(func(field map[string]*Field) (bool, error) {
+		has = true
+		return false, nil
+	})
+	return
+}
+
+// Pluck 查找一个字段的值,解析到切片中,需要先设置表名,例 Table(new(Person)).Pluck("name",&[]string{})
+func (this *Action) Pluck(col string, i interface{}) (err error) {
+	defer this.dealErr(&err)
+	if err := this.setTable(); err != nil {
+		return err
+	}
+	if len(this.TableName) == 0 {
+		return errors.New("未设置表名")
+	}
+	this.checks = append(this.checks, checkCol(col))
+	ls := []interface{}(nil)
+	err = this.rangeResult(func(field map[string]*Field) (bool, error) {
+		val, ok := field[col]
+		if !ok {
+			return false, fmt.Errorf("字段(%s)不在查询的字段中", col)
+		}
+		ls = append(ls, val.Val())
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+	return this.db.unmarshal(ls, i)
+}
+
+// Distinct 去重,只保留字段值第一次出现的数据,结果只包含这些字段,例 Distinct("name,age")
+func (this *Action) Distinct(cols ...string) *Action {
+	ls := splitCols(cols)
+	for _, v := range ls {
+		this.checks = append(this.checks, checkCol(v))
+	}
+	if len(ls) == 0 {
+		return this
+	}
+	this.distinct = append(this.distinct, ls...)
+	return this.Cols(ls...)
+}
+
 // Insert 插入到数据库
 func (this *Action) Insert(i ...interface{}) (err error) {
 	defer this.dealErr(&err)
+	if len(this.joins) > 0 {
+		return errors.New("关联查询不支持插入")
+	}
 	//获取表名称
 	if err := this.setTable(i); err != nil {
 		return err
 	}
 
+	//主键需要大于表中已有的主键
+	if err := this.db.seedID(this.TableName); err != nil {
+		return err
+	}
+	defer this.lockTable()()
+
 	//整理字段结构
 	return this.scanner.AppendWith(func() ([][]byte, error) {
 		ls := [][]byte(nil)
@@ -225,31 +483,163 @@ func (this *Action) Insert(i ...interface{}) (err error) {
 	})
 }
 
-func (this *Action) Update(i interface{}) (err error) {
+// InsertOrUpdate 按主键或keys字段查找数据,存在则修改(主键不变),不存在则插入,在一次文件写入中完成,
+// 返回是否是插入,例 InsertOrUpdate(&Config{Key:"name",Value:"小米"},"key")
+func (this *Action) InsertOrUpdate(i interface{}, keys ...string) (inserted bool, err error) {
 	defer this.dealErr(&err)
+	if len(this.joins) > 0 {
+		return false, errors.New("关联查询不支持插入")
+	}
+	//获取表名称
+	if err := this.setTable(i); err != nil {
+		return false, err
+	}
+	//主键需要大于表中已有的主键
+	if err := this.db.seedID(this.TableName); err != nil {
+		return false, err
+	}
+	defer this.lockTable()()
 
+	update := make(map[string]interface{})
+	if err := this.db.unmarshal(i, &update); err != nil {
+		return false, err
+	}
+	if len(keys) == 0 {
+		keys = []string{this.db.id}
+	}
+	for _, key := range keys {
+		if _, ok := update[key]; !ok {
+			return false, fmt.Errorf("字段(%s)没有值", key)
+		}
+		this.checks = append(this.checks, checkCol(key))
+	}
+
+	inserted = true
+	err = this.scanner.UpdateWith(func(index int, bs []byte) ([][]byte, error) {
+		field := this.table.DecodeData2(bs, this.db.split)
+		for _, key := range keys {
+			if !field[key].compare("=", update[key]) {
+				return [][]byte{bs}, nil
+			}
+		}
+		inserted = false
+		m := make(map[string]interface{})
+		for k, v := range field {
+			m[k] = v.Value
+		}
+		for k, v := range update {
+			//主键不能修改
+			if k != this.db.id {
+				if _, ok := field[k]; ok {
+					m[k] = v
+				}
+			}
+		}
+		return [][]byte{this.table.EncodeData(m, this.db.split)}, nil
+	}, func() ([][]byte, error) {
+		if !inserted {
+			return nil, nil
+		}
+		//设置自增主键,并赋值到原先的数据字段中
+		update[this.db.id] = this.db.getID()
+		this.db.unmarshal(update, i)
+		return [][]byte{this.table.EncodeData(update, this.db.split)}, nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return inserted, nil
+}
+
+// setExpr 修改时按表达式计算的字段
+type setExpr struct {
+	Col  string //字段
+	Expr expr   //表达式,按修改前的数据计算
+}
+
+// SetExpr 修改时字段按表达式计算,在修改的同一次遍历中按每条数据计算,例 SetExpr("total","total + ?",n)
+func (this *Action) SetExpr(col, s string, args ...interface{}) *Action {
+	if this.Err != nil {
+		return this
+	}
+	if col == this.db.id {
+		//主键不能修改,After和ID依赖主键的顺序
+		this.Err = fmt.Errorf("主键(%s)不能修改", col)
+		return this
+	}
+	e, err := parseSet(s, args...)
+	if err != nil {
+		this.Err = err
+		return this
+	}
+	this.sets = append(this.sets, &setExpr{Col: col, Expr: e})
+	this.checks = append(this.checks, checkCol(col), func(t *Table) error { return checkKeys(e, t) })
+	return this
+}
+
+// Incr 修改时字段增加n,默认为1,例 Where("time=?",id).Incr("retry_count").Update(new(Job))
+func (this *Action) Incr(col string, n ...interface{}) *Action {
+	return this.SetExpr(col, col+" + ?", conv.Default[interface{}](1, n...))
+}
+
+// Decr 修改时字段减少n,默认为1
+func (this *Action) Decr(col string, n ...interface{}) *Action {
+	return this.SetExpr(col, col+" - ?", conv.Default[interface{}](1, n...))
+}
+
+// lockTable 写操作锁定表,表已经锁定(事务提交)时不再锁定
+func (this *Action) lockTable() func() {
+	if this.locked {
+		return func() {}
+	}
+	return this.db.lockTable(this.TableName)
+}
+
+// Update 修改符合条件的数据,返回修改的数量
+// 结构体的零值字段默认不修改,可通过Cols,MustCols,AllCols及Omit指定修改的字段,map的字段全部修改
+func (this *Action) Update(i interface{}) (co int64, err error) {
+	defer this.dealErr(&err)
+
+	if len(this.joins) > 0 {
+		return 0, errors.New("关联查询不支持修改")
+	}
 	//获取表名称
 	if err := this.setTable(i); err != nil {
-		return err
+		return 0, err
 	}
 
+	defer this.lockTable()()
+
 	//校验是否忘记增加删除的条件
-	if len(this.Handler) == 0 && this.LimitHandler == nil {
-		return errors.New("修改是否忘记增加条件")
+	if len(this.Handler) == 0 && !this.limited {
+		return 0, errors.New("修改是否忘记增加条件")
 	}
 
 	//解析数据到map中
 	update := make(map[string]interface{})
 	if err := this.db.unmarshal(i, &update); err != nil {
-		return err
+		return 0, err
+	}
+	update = this.updateCols(i, update)
+	if reflect.Indirect(reflect.ValueOf(i)).Kind() == reflect.Map {
+		//map的字段需要在表头中,主键不能修改,避免写错字段时没有修改却返回修改的数量
+		for k := range update {
+			if k == this.db.id {
+				return 0, fmt.Errorf("主键(%s)不能修改", k)
+			}
+			this.checks = append(this.checks, checkCol(k))
+		}
 	}
 
-	return this.scanner.Update(func(i int, bs []byte) ([][]byte, error) {
+	index := 0
+	err = this.scanner.Update(func(i int, bs []byte) ([][]byte, error) {
 
 		flied := this.table.DecodeData2(bs, this.db.split)
 		original := make(map[string]string)
+		row := make(map[string]*Field) //修改前的数据,用于计算表达式
 		for k, v := range flied {
 			original[k] = v.Value
+			row[k] = v
 		}
 		for _, fn := range this.Handler {
 			if mate, err := fn(flied); err != nil {
@@ -260,11 +650,12 @@ func (this *Action) Update(i interface{}) (err error) {
 			}
 		}
 
-		if this.LimitHandler != nil {
-			if this.LimitHandler(i, original) {
-				//不符合的数据原路返回
-				return [][]byte{bs}, nil
-			}
+		//数据分页,按符合条件的数据计算
+		in, _ := this.paging(index)
+		index++
+		if !in {
+			//不在分页内的数据原路返回
+			return [][]byte{bs}, nil
 		}
 
 		m := make(map[string]interface{})
@@ -280,38 +671,73 @@ func (this *Action) Update(i interface{}) (err error) {
 			}
 		}
 
-		result := this.table.EncodeData(m, this.db.split)
+		for _, set := range this.sets {
+			val, err := set.Expr.eval(row)
+			if err != nil {
+				return nil, fmt.Errorf("字段(%s): %v", set.Col, err)
+			}
+			if m[set.Col], err = convertType(row[set.Col].Type, val); err != nil {
+				return nil, fmt.Errorf("字段(%s): %v", set.Col, err)
+			}
+		}
 
+		result := this.table.EncodeData(m, this.db.split)
+		co++
 		return [][]byte{result}, nil
 	})
+	return this.affected(co, err)
 }
 
-func (this *Action) Delete(i ...any) (err error) {
+// Delete 删除符合条件的数据,返回删除的数量
+func (this *Action) Delete(i ...any) (co int64, err error) {
 	defer this.dealErr(&err)
 
+	if len(this.joins) > 0 {
+		return 0, errors.New("关联查询不支持删除")
+	}
 	//获取表名称
 	if err := this.setTable(i); err != nil {
-		return err
+		return 0, err
 	}
 
+	defer this.lockTable()()
+
 	//校验是否忘记增加删除的条件
-	if len(this.Handler) == 0 && this.LimitHandler == nil {
-		return errors.New("删除是否忘记增加条件")
+	if len(this.Handler) == 0 && !this.limited {
+		return 0, errors.New("删除是否忘记增加条件")
 	}
 
-	return this.scanner.DelBy(func(i int, bs []byte) (bool, error) {
-		del := true
+	index := 0
+	err = this.scanner.DelBy(func(i int, bs []byte) (bool, error) {
 		flied := this.table.DecodeData2(bs, this.db.split)
 		for _, fn := range this.Handler {
 			if mate, err := fn(flied); err != nil {
 				return false, err
 			} else if !mate {
 				//不匹配的数据不删除
-				del = false
+				return false, nil
 			}
 		}
-		return del, nil
+		//数据分页,按符合条件的数据计算
+		in, _ := this.paging(index)
+		index++
+		if in {
+			co++
+		}
+		return in, nil
 	})
+	return this.affected(co, err)
+}
+
+// affected 修改或删除的结果,设置了WithAffectedErr时,没有修改或删除数据返回ErrNotAffected
+func (this *Action) affected(co int64, err error) (int64, error) {
+	if err != nil {
+		return 0, err
+	}
+	if co == 0 && this.db.affectedErr {
+		return 0, ErrNotAffected
+	}
+	return co, nil
 }
 
 /*
@@ -363,61 +789,156 @@ func (this *Action) setTable(i ...interface{}) error {
 			return nil, err
 		}
 		this.table, err = this.db.DecodeTable(ls)
-		return ls, err
+		if err != nil {
+			return nil, err
+		}
+		if len(this.joins) > 0 {
+			if err := this.setJoined(); err != nil {
+				return nil, err
+			}
+		}
+		//操作数据前进行校验
+		for _, check := range this.checks {
+			if err := check(this.header()); err != nil {
+				return nil, err
+			}
+		}
+		return ls, nil
 	})
 	return nil
 }
 
 func (this *Action) find() error {
-	return this.scanner.WithScanner(func(f *os.File, p [][]byte, s *core.Scanner) error {
-		return this.table.DecodeData(s, this.db.split, func(index int, field map[string]*Field) (bool, error) {
-			//数据筛选
-			for _, fn := range this.Handler {
-				if mate, err := fn(field); err != nil {
-					return false, err
-				} else if !mate {
-					//不符合的数据不进行下一步处理
-					return true, nil
-				}
-			}
-			//数据分页
-			if this.LimitHandler == nil {
-				this.LimitHandler = func(index int, field map[string]string) bool {
-					this.Result = append(this.Result, field)
-					return false
-				}
+	return this.rangeResult(func(field map[string]*Field) (bool, error) {
+		this.Result = append(this.Result, fieldString(field))
+		return true, nil
+	})
+}
+
+// rangeResult 遍历查询的结果,经过筛选,分组,排序和分页
+func (this *Action) rangeResult(fn func(field map[string]*Field) (bool, error)) error {
+	if result := fn; len(this.cols) > 0 || len(this.omit) > 0 {
+		fn = func(field map[string]*Field) (bool, error) {
+			return result(this.project(field))
+		}
+	}
+	if this.SortHandler != nil || this.grouped() {
+		return this.rangeSort(fn)
+	}
+	index := 0
+	return this.rangeMate(func(field map[string]*Field) (bool, error) {
+		//数据分页,按符合条件的数据计算
+		in, next := this.paging(index)
+		index++
+		if this.total != nil {
+			//统计总数量时遍历全部数据
+			*this.total++
+			next = true
+		}
+		if !in {
+			return next, nil
+		}
+		if ok, err := fn(field); err != nil || !ok {
+			return false, err
+		}
+		return next, nil
+	})
+}
+
+// rangeRows 遍历查询的数据(排序分页前),分组查询时为每组的数据
+func (this *Action) rangeRows(fn func(field map[string]*Field) (bool, error)) error {
+	if this.total != nil {
+		next := fn
+		fn = func(field map[string]*Field) (bool, error) {
+			*this.total++
+			return next(field)
+		}
+	}
+	if this.grouped() {
+		return this.rangeGroup(fn)
+	}
+	return this.rangeMate(fn)
+}
+
+// rangeMate 遍历符合筛选条件的数据
+func (this *Action) rangeMate(fn func(field map[string]*Field) (bool, error)) error {
+	seen := make(map[string]bool)
+	return this.rangeTable(func(field map[string]*Field) (bool, error) {
+		//数据筛选
+		for _, fn := range this.Handler {
+			if mate, err := fn(field); err != nil {
+				return false, err
+			} else if !mate {
+				//不符合的数据不进行下一步处理
+				return true, nil
 			}
-			m := make(map[string]string)
-			for k, v := range field {
-				m[k] = v.Value
+		}
+		//去重,在全部筛选条件之后
+		if len(this.distinct) > 0 {
+			key := this.fieldKey(field, this.distinct)
+			if seen[key] {
+				return true, nil
 			}
+			seen[key] = true
+		}
+		return fn(field)
+	})
+}
 
-			if this.LimitHandler(index, m) {
+// rangeTable 遍历表的数据,有关联查询时为关联后的数据
+func (this *Action) rangeTable(fn func(field map[string]*Field) (bool, error)) error {
+	if len(this.joins) > 0 {
+		return this.rangeJoin(len(this.joins), fn)
+	}
+	//按主键查询且主键有序时,超过最大的主键后结束遍历
+	stop := len(this.ids) > 0 && this.db.ordered(this.TableName)
+	return this.withScanner(func(f *os.File, p [][]byte, s *core.Scanner) error {
+		return this.table.DecodeData(s, this.db.split, func(index int, field map[string]*Field) (bool, error) {
+			if id, ok := field[this.db.id]; ok && stop && conv.Int64(id.Value) > this.ids[len(this.ids)-1] {
 				return false, nil
 			}
-
-			return true, nil
+			return fn(field)
 		})
 	})
+}
 
+// withScanner 读取表数据,设置了After时从主键大于该值的数据开始读取
+func (this *Action) withScanner(fn func(f *os.File, p [][]byte, s *core.Scanner) error) error {
+	//二分查找的起始主键(包括)
+	min := int64(0)
+	if this.after != 0 {
+		min = this.after + 1
+	}
+	if len(this.ids) > 0 && this.ids[0] > min {
+		min = this.ids[0]
+	}
+	//主键无序时(例时钟回拨,其他程序写入)遍历全部数据
+	if min == 0 || !this.db.ordered(this.TableName) {
+		return this.scanner.WithScanner(fn)
+	}
+	return this.scanner.SearchScanner(func(bs []byte) bool {
+		field, ok := this.table.Fields.Map()[this.db.id]
+		if !ok {
+			return false
+		}
+		ls := bytes.Split(bs, this.db.split)
+		return field.Index < len(ls) && conv.Int64(string(ls[field.Index])) >= min
+	}, fn)
 }
 
 func (this *Action) count() (int64, error) {
 	count := int64(0)
-	err := this.scanner.WithScanner(func(f *os.File, p [][]byte, s *core.Scanner) error {
-		return this.table.DecodeData(s, this.db.split, func(index int, field map[string]*Field) (bool, error) {
-			//数据筛选
-			for _, fn := range this.Handler {
-				if mate, err := fn(field); err != nil {
-					return false, err
-				} else if !mate {
-					//不符合的数据不进行下一步处理
-					return true, nil
-				}
-			}
+	if this.grouped() {
+		//分组查询时为分组的数量
+		err := this.rangeGroup(func(field map[string]*Field) (bool, error) {
 			count++
 			return true, nil
 		})
+		return count, err
+	}
+	err := this.rangeMate(func(field map[string]*Field) (bool, error) {
+		count++
+		return true, nil
 	})
 	return count, err
 }
@@ -0,0 +1,217 @@
+package minidb
+
+import (
+	"fmt"
+	"github.com/injoyai/conv"
+)
+
+const (
+	aggCount = "count"
+	aggSum   = "sum"
+	aggAvg   = "avg"
+	aggMin   = "min"
+	aggMax   = "max"
+)
+
+// aggregate 聚合计算,按表头声明的类型计算
+type aggregate struct {
+	Func string //聚合函数 count,sum,avg,min,max
+	Key  string //字段名称,count时可为*
+	As   string //结果名称
+	Type string //字段类型
+
+	count    int64   //数量
+	sumInt   int64   //Int类型的和
+	sumFloat float64 //Float类型的和
+	value    *Field  //min,max的当前值
+}
+
+func newAggregate(fn, key string) *aggregate {
+	return &aggregate{Func: fn, Key: key, As: fmt.Sprintf("%s(%s)", fn, key)}
+}
+
+// check 校验字段是否存在,及类型是否支持
+func (this *aggregate) check(t *Table) error {
+	if this.Func == aggCount && this.Key == "*" {
+		return nil
+	}
+	field, ok := t.Fields.Map()[this.Key]
+	if !ok {
+		return fmt.Errorf("字段(%s)不存在", this.Key)
+	}
+	switch this.Func {
+	case aggCount, aggMin, aggMax:
+	case aggSum, aggAvg:
+		if field.Type != Int && field.Type != Float {
+			return fmt.Errorf("字段(%s)类型(%s)不支持%s", this.Key, field.Type, this.Func)
+		}
+	default:
+		return fmt.Errorf("未知的聚合函数(%s)", this.Func)
+	}
+	return nil
+}
+
+// add 累加一行数据
+func (this *aggregate) add(field map[string]*Field) {
+	if this.Func == aggCount && this.Key == "*" {
+		this.count++
+		return
+	}
+	val, ok := field[this.Key]
+	if !ok {
+		return
+	}
+	this.count++
+	this.Type = val.Type
+	switch this.Func {
+	case aggSum, aggAvg:
+		switch val.Type {
+		case Int:
+			this.sumInt += conv.Int64(val.Value)
+		case Float:
+			this.sumFloat += conv.Float64(val.Value)
+		}
+	case aggMin:
+		if this.value == nil || val.compare("<", this.value.Value) {
+			this.value = val
+		}
+	case aggMax:
+		if this.value == nil || val.compare(">", this.value.Value) {
+			this.value = val
+		}
+	}
+}
+
+// Field 聚合结果,min,max无数据时值为nil
+func (this *aggregate) Field() *Field {
+	result := &Field{Name: this.As}
+	switch this.Func {
+	case aggCount:
+		result.Type = Int
+		result.Value = conv.String(this.count)
+	case aggSum:
+		result.Type = this.Type
+		if this.Type == Float {
+			result.Value = conv.String(this.sumFloat)
+		} else {
+			result.Type = Int
+			result.Value = conv.String(this.sumInt)
+		}
+	case aggAvg:
+		result.Type = Float
+		result.Value = "0"
+		if this.count > 0 {
+			result.Value = conv.String((float64(this.sumInt) + this.sumFloat) / float64(this.count))
+		}
+	case aggMin, aggMax:
+		if this.value == nil {
+			return nil
+		}
+		result.Type = this.value.Type
+		result.Value = this.value.Value
+	}
+	return result
+}
+
+// aggregate 遍历符合条件的数据,对字段进行聚合计算
+func (this *Action) aggregate(i interface{}, fn string, cols ...string) ([]*Field, error) {
+	if err := this.setTable(i); err != nil {
+		return nil, err
+	}
+	if len(cols) == 0 {
+		return nil, fmt.Errorf("%s缺少字段", fn)
+	}
+	ls := make([]*aggregate, len(cols))
+	for k, col := range cols {
+		ls[k] = newAggregate(fn, col)
+		this.checks = append(this.checks, ls[k].check)
+	}
+	err := this.rangeMate(func(field map[string]*Field) (bool, error) {
+		for _, agg := range ls {
+			agg.add(field)
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*Field, len(ls))
+	for k, agg := range ls {
+		result[k] = agg.Field()
+	}
+	return result, nil
+}
+
+// Sum 求和,例 Sum(new(Person),"age","high") ,Int字段超过2^53时会丢失精度,需要精确值时使用SumInt
+func (this *Action) Sum(i interface{}, cols ...string) (result []float64, err error) {
+	defer this.dealErr(&err)
+	ls, err := this.aggregate(i, aggSum, cols...)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range ls {
+		result = append(result, conv.Float64(v.Value))
+	}
+	return
+}
+
+// SumInt Int字段求和,按int64精确计算,例 SumInt(new(Log),"bytes")
+func (this *Action) SumInt(i interface{}, cols ...string) (result []int64, err error) {
+	defer this.dealErr(&err)
+	for _, col := range cols {
+		col := col
+		this.checks = append(this.checks, func(t *Table) error {
+			if field, ok := t.Fields.Map()[col]; ok && field.Type != Int {
+				return fmt.Errorf("字段(%s)类型(%s)不是%s", col, field.Type, Int)
+			}
+			return nil
+		})
+	}
+	ls, err := this.aggregate(i, aggSum, cols...)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range ls {
+		result = append(result, conv.Int64(v.Value))
+	}
+	return
+}
+
+// Avg 求平均值,无数据时为0
+func (this *Action) Avg(i interface{}, cols ...string) (result []float64, err error) {
+	defer this.dealErr(&err)
+	ls, err := this.aggregate(i, aggAvg, cols...)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range ls {
+		result = append(result, conv.Float64(v.Value))
+	}
+	return
+}
+
+// Min 最小值,按字段类型返回int64,float64,bool,string,无数据时为nil
+func (this *Action) Min(i interface{}, cols ...string) (result []interface{}, err error) {
+	defer this.dealErr(&err)
+	ls, err := this.aggregate(i, aggMin, cols...)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range ls {
+		result = append(result, v.Val())
+	}
+	return
+}
+
+// Max 最大值,按字段类型返回int64,float64,bool,string,无数据时为nil
+func (this *Action) Max(i interface{}, cols ...string) (result []interface{}, err error) {
+	defer this.dealErr(&err)
+	ls, err := this.aggregate(i, aggMax, cols...)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range ls {
+		result = append(result, v.Val())
+	}
+	return
+}
@@ -0,0 +1,255 @@
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"github.com/injoyai/conv"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+/*
+Cond 条件构造,参考xorm的builder,值全部以参数(?)的方式传递,
+构造时校验字段和值,错误保存在Err中,例:
+
+	builder.Or(
+		builder.And(builder.Eq("name", "小米"), builder.Gt("age", 18)),
+		builder.In("id", []int{1, 2, 3}),
+	)
+
+使用 db.Where(cond) 或 action.And(cond)
+*/
+type Cond struct {
+	sql  string
+	args []interface{}
+	Err  error //构造时的错误
+}
+
+// ToSQL 生成条件语句及参数
+func (this Cond) ToSQL() (string, []interface{}, error) {
+	return this.sql, this.args, this.Err
+}
+
+// IsValid 是否有效,无错误且有条件
+func (this Cond) IsValid() bool {
+	return this.Err == nil && len(this.sql) > 0
+}
+
+func (this Cond) String() string {
+	if this.Err != nil {
+		return this.Err.Error()
+	}
+	return this.sql
+}
+
+// And 和其他条件组合成and关系
+func (this Cond) And(conds ...Cond) Cond {
+	return And(append([]Cond{this}, conds...)...)
+}
+
+// Or 和其他条件组合成or关系
+func (this Cond) Or(conds ...Cond) Cond {
+	return Or(append([]Cond{this}, conds...)...)
+}
+
+/*
+
+
+
+ */
+
+// Eq 等于,例 Eq("name","小米")
+func Eq(col string, value interface{}) Cond {
+	return compare(col, "=", value)
+}
+
+// Neq 不等于
+func Neq(col string, value interface{}) Cond {
+	return compare(col, "!=", value)
+}
+
+// Gt 大于
+func Gt(col string, value interface{}) Cond {
+	return compare(col, ">", value)
+}
+
+// Gte 大于等于
+func Gte(col string, value interface{}) Cond {
+	return compare(col, ">=", value)
+}
+
+// Lt 小于
+func Lt(col string, value interface{}) Cond {
+	return compare(col, "<", value)
+}
+
+// Lte 小于等于
+func Lte(col string, value interface{}) Cond {
+	return compare(col, "<=", value)
+}
+
+// Like 模糊查询,例 Like("name","小%") ,不包含%时为包含查询,例 Like("name","小")
+func Like(col string, value string) Cond {
+	if !strings.Contains(value, "%") {
+		value = "%" + strings.NewReplacer(`\`, `\\`, `_`, `\_`).Replace(value) + "%"
+	}
+	return compare(col, "like", value)
+}
+
+// Regexp 正则匹配,例 Regexp("name","^小.$")
+func Regexp(col string, value string) Cond {
+	if _, err := regexp.Compile(value); err != nil {
+		return Cond{Err: fmt.Errorf("字段(%s)的正则(%s)错误: %v", col, value, err)}
+	}
+	return compare(col, "regexp", value)
+}
+
+// Between 在区间内(包含两端)
+func Between(col string, start, end interface{}) Cond {
+	if err := checkCol(col); err != nil {
+		return Cond{Err: err}
+	}
+	if err := checkValue(col, start); err != nil {
+		return Cond{Err: err}
+	}
+	if err := checkValue(col, end); err != nil {
+		return Cond{Err: err}
+	}
+	return Cond{
+		sql:  col + " between ? and ?",
+		args: []interface{}{start, end},
+	}
+}
+
+// In 在列表中,值可以是多个,或者一个切片,例 In("id",1,2,3) , In("id",[]int{1,2,3})
+func In(col string, values ...interface{}) Cond {
+	return in(col, "in", values...)
+}
+
+// NotIn 不在列表中
+func NotIn(col string, values ...interface{}) Cond {
+	return in(col, "not in", values...)
+}
+
+// And 全部符合,忽略无条件的Cond
+func And(conds ...Cond) Cond {
+	return join(" and ", conds...)
+}
+
+// Or 任意一个符合,忽略无条件的Cond
+func Or(conds ...Cond) Cond {
+	return join(" or ", conds...)
+}
+
+// Not 取反
+func Not(cond Cond) Cond {
+	if cond.Err != nil {
+		return cond
+	}
+	if len(cond.sql) == 0 {
+		return Cond{Err: errors.New("not缺少条件")}
+	}
+	return Cond{
+		sql:  "not (" + cond.sql + ")",
+		args: cond.args,
+	}
+}
+
+/*
+
+
+
+ */
+
+// regCol 字段名称,字母数字下划线和点(关联查询时为表名.字段)
+var regCol = regexp.MustCompile(`^[\p{L}_][\p{L}\p{N}_.]*$`)
+
+func checkCol(col string) error {
+	if !regCol.MatchString(col) {
+		return fmt.Errorf("无效的字段名称(%s)", col)
+	}
+	switch strings.ToLower(col) {
+	case "and", "or", "not", "like", "regexp", "escape", "in", "between":
+		return fmt.Errorf("字段名称(%s)不能是关键字", col)
+	}
+	return nil
+}
+
+func checkValue(col string, value interface{}) error {
+	if value == nil {
+		return fmt.Errorf("字段(%s)的值不能为nil", col)
+	}
+	switch value.(type) {
+	case []byte, time.Time:
+		return nil
+	}
+	switch reflect.ValueOf(value).Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map, reflect.Struct, reflect.Func, reflect.Chan:
+		return fmt.Errorf("字段(%s)的值类型(%T)无效", col, value)
+	}
+	return nil
+}
+
+func compare(col, op string, value interface{}) Cond {
+	if err := checkCol(col); err != nil {
+		return Cond{Err: err}
+	}
+	if err := checkValue(col, value); err != nil {
+		return Cond{Err: err}
+	}
+	return Cond{
+		sql:  col + " " + op + " ?",
+		args: []interface{}{value},
+	}
+}
+
+func in(col, op string, values ...interface{}) Cond {
+	if err := checkCol(col); err != nil {
+		return Cond{Err: err}
+	}
+	if len(values) == 1 {
+		switch values[0].(type) {
+		case string, []byte:
+		default:
+			values = conv.Interfaces(values[0])
+		}
+	}
+	if len(values) == 0 {
+		return Cond{Err: fmt.Errorf("字段(%s)的%s列表不能为空", col, op)}
+	}
+	for _, v := range values {
+		if err := checkValue(col, v); err != nil {
+			return Cond{Err: err}
+		}
+	}
+	return Cond{
+		sql:  col + " " + op + " (" + strings.TrimSuffix(strings.Repeat("?,", len(values)), ",") + ")",
+		args: values,
+	}
+}
+
+func join(sep string, conds ...Cond) Cond {
+	ls := []Cond(nil)
+	for _, v := range conds {
+		if v.Err != nil {
+			return v
+		}
+		if len(v.sql) > 0 {
+			ls = append(ls, v)
+		}
+	}
+	if len(ls) == 1 {
+		return ls[0]
+	}
+	result := Cond{}
+	for i, v := range ls {
+		if i > 0 {
+			result.sql += sep
+		}
+		result.sql += "(" + v.sql + ")"
+		result.args = append(result.args, v.args...)
+	}
+	return result
+}
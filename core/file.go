@@ -50,6 +50,58 @@ func (this *File) WithScanner(fn func(f *os.File, p [][]byte, s *Scanner) error)
 	return fn(file, prefix, scanner)
 }
 
+// SearchScanner 二分查找第一条search为true的数据,从该条数据开始遍历,
+// 数据需要有序,即前面的数据都为false,后面的数据都为true,例按递增的主键查找
+func (this *File) SearchScanner(search func(bs []byte) bool, fn func(f *os.File, p [][]byte, s *Scanner) error) error {
+	return this.WithScanner(func(f *os.File, p [][]byte, s *Scanner) error {
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		//数据开始的位置,跳过被消费(OnOpen)的数据
+		start := int64(0)
+		for _, bs := range p {
+			start += int64(len(bs) + len(this.Split))
+		}
+		size := info.Size()
+		result, lo, hi := size, start, size
+		for lo < hi {
+			mid := lo + (hi-lo)/2
+			offset, bs, ok, err := this.next(f, start, mid, size)
+			if err != nil {
+				return err
+			}
+			switch {
+			case !ok:
+				hi = mid
+			case search(bs):
+				result, hi = offset, mid
+			default:
+				lo = offset + int64(len(bs)+len(this.Split))
+			}
+		}
+		return fn(f, p, this.NewScanner(io.NewSectionReader(f, result, size-result)))
+	})
+}
+
+// next 读取offset(包括)之后开始的第一条数据,返回数据开始的位置
+func (this *File) next(f *os.File, start, offset, size int64) (int64, []byte, bool, error) {
+	if offset > start {
+		//从前一个分隔符开始读取,第一段为offset所在数据的剩余部分
+		offset -= int64(len(this.Split))
+		s := this.NewScanner(io.NewSectionReader(f, offset, size-offset))
+		if !s.Scan() {
+			return 0, nil, false, s.Err()
+		}
+		offset += int64(len(s.Bytes()) + len(this.Split))
+	}
+	s := this.NewScanner(io.NewSectionReader(f, offset, size-offset))
+	if !s.Scan() {
+		return 0, nil, false, s.Err()
+	}
+	return offset, s.Bytes(), true, nil
+}
+
 func (this *File) OnOpen(f func(s *Scanner) ([][]byte, error)) {
 	this.OpenFunc = f
 }
@@ -106,6 +158,24 @@ func (this *File) AppendWith(fn func() ([][]byte, error)) error {
 	})
 }
 
+// Create 新建文件并写入数据,文件已存在则清空
+func (this *File) Create(data ...[]byte) error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	file, err := os.Create(this.Filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	if err := this.write(writer, data...); err != nil {
+		return err
+	}
+	return writer.Flush()
+}
+
 // Insert 插入数据,其实就是更新数据,变成多条数据
 func (this *File) Insert(index int, data []byte) error {
 	return this.Update(func(i int, bs []byte) ([][]byte, error) {
@@ -118,6 +188,11 @@ func (this *File) Insert(index int, data []byte) error {
 
 // Update 更新数据
 func (this *File) Update(fn func(i int, bs []byte) ([][]byte, error)) (err error) {
+	return this.UpdateWith(fn, nil)
+}
+
+// UpdateWith 更新数据,遍历结束后追加end返回的数据,在同一次写入中完成
+func (this *File) UpdateWith(fn func(i int, bs []byte) ([][]byte, error), end func() ([][]byte, error)) (err error) {
 	//临时文件名称
 	tempFilename := this.Filename + ".temp"
 	defer func() {
@@ -158,6 +233,16 @@ func (this *File) Update(fn func(i int, bs []byte) ([][]byte, error)) (err error
 			return err
 		}
 
+		if end != nil {
+			data, err := end()
+			if err != nil {
+				return err
+			}
+			if err := this.write(writer, data...); err != nil {
+				return err
+			}
+		}
+
 		//写入磁盘,减少写入次数
 		return writer.Flush()
 	})
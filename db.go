@@ -38,6 +38,23 @@ func WithDir(dir string) Option {
 	}
 }
 
+// WithMemory 设置排序等操作使用的内存上限(字节),超过则使用临时文件
+func WithMemory(size int) Option {
+	return func(db *DB) {
+		db.memory = size
+	}
+}
+
+// WithAffectedErr 修改或删除时没有符合条件的数据,返回错误ErrNotAffected
+func WithAffectedErr(enable bool) Option {
+	return func(db *DB) {
+		db.affectedErr = enable
+	}
+}
+
+// ErrNotAffected 没有修改或删除数据,需要设置WithAffectedErr
+var ErrNotAffected = errors.New("没有符合条件的数据")
+
 type Option func(db *DB)
 
 func New(dir string, option ...Option) *DB {
@@ -49,6 +66,7 @@ func New(dir string, option ...Option) *DB {
 		split:   []byte{' ', 0xFF, ' '},
 		tag:     "orm",
 		id:      "time",
+		memory:  1 << 20,
 		scanner: core.NewFile("", 0),
 	}
 	for _, op := range option {
@@ -69,13 +87,18 @@ DB
 第13行值: 	1 , 小明 , 18 , 180.2 , true
 */
 type DB struct {
-	dir     string
-	split   []byte
-	tag     string
-	id      string
-	lastID  int64
-	mu      sync.Mutex
-	scanner *core.File
+	dir         string
+	split       []byte
+	tag         string
+	id          string
+	lastID      int64
+	memory      int  //排序等操作使用的内存上限
+	affectedErr bool //修改或删除时没有符合条件的数据是否返回错误
+	mu          sync.Mutex
+	locks       sync.Map //表的写锁,同一个DB对同一个表的写操作依次进行
+	orders      sync.Map //表的主键顺序,见order
+	seeded      sync.Map //已按表中最大的主键设置lastID的表
+	scanner     *core.File
 }
 
 func (this *DB) ID() string {
@@ -290,25 +313,77 @@ func (this *DB) Table(table interface{}) *Action {
 	return this.NewAction().Table(table)
 }
 
-// Where Where("Name=?","小明")
-func (this *DB) Where(s string, args ...interface{}) *Action {
-	return this.NewAction().Where(s, args...)
+// Where Where("Name=?","小明") , Where(builder.Eq("Name","小明"))
+func (this *DB) Where(query interface{}, args ...interface{}) *Action {
+	return this.NewAction().Where(query, args...)
+}
+
+func (this *DB) WhereFunc(fn func(row map[string]*Field) bool) *Action {
+	return this.NewAction().WhereFunc(fn)
+}
+
+func (this *DB) WhereBean(bean interface{}, fn func(bean interface{}) bool) *Action {
+	return this.NewAction().WhereBean(bean, fn)
 }
 
 func (this *DB) Limit(size int, offset ...int) *Action {
 	return this.NewAction().Limit(size, offset...)
 }
 
+func (this *DB) After(id int64) *Action {
+	return this.NewAction().After(id)
+}
+
+func (this *DB) Desc(filed string) *Action {
+	return this.NewAction().Desc(filed)
+}
+
+func (this *DB) Asc(filed string) *Action {
+	return this.NewAction().Asc(filed)
+}
+
+func (this *DB) Distinct(cols ...string) *Action {
+	return this.NewAction().Distinct(cols...)
+}
+
+func (this *DB) SetExpr(col, s string, args ...interface{}) *Action {
+	return this.NewAction().SetExpr(col, s, args...)
+}
+
+func (this *DB) Incr(col string, n ...interface{}) *Action {
+	return this.NewAction().Incr(col, n...)
+}
+
+func (this *DB) Decr(col string, n ...interface{}) *Action {
+	return this.NewAction().Decr(col, n...)
+}
+
 func (this *DB) Insert(i ...interface{}) error {
 	return this.NewAction().Insert(i...)
 }
 
-func (this *DB) Get(i interface{}) (bool, error) {
-	return this.NewAction().Get(i)
+func (this *DB) InsertOrUpdate(i interface{}, keys ...string) (bool, error) {
+	return this.NewAction().InsertOrUpdate(i, keys...)
+}
+
+func (this *DB) Get(i interface{}, conds ...interface{}) (bool, error) {
+	return this.NewAction().Get(i, conds...)
 }
 
-func (this *DB) Find(i interface{}) error {
-	return this.NewAction().Find(i)
+func (this *DB) Find(i interface{}, conds ...interface{}) error {
+	return this.NewAction().Find(i, conds...)
+}
+
+func (this *DB) Iterate(bean interface{}, fn func(i int, bean interface{}) error) error {
+	return this.NewAction().Iterate(bean, fn)
+}
+
+func (this *DB) Rows(bean interface{}) (*Rows, error) {
+	return this.NewAction().Rows(bean)
+}
+
+func (this *DB) Exist(i ...interface{}) (bool, error) {
+	return this.NewAction().Exist(i...)
 }
 
 func (this *DB) Count(i ...interface{}) (int64, error) {
@@ -319,6 +394,30 @@ func (this *DB) FindAndCount(i interface{}) (int64, error) {
 	return this.NewAction().FindAndCount(i)
 }
 
+func (this *DB) Page(i interface{}, pageNo, pageSize int) (Page, error) {
+	return this.NewAction().Page(i, pageNo, pageSize)
+}
+
+func (this *DB) Sum(i interface{}, cols ...string) ([]float64, error) {
+	return this.NewAction().Sum(i, cols...)
+}
+
+func (this *DB) SumInt(i interface{}, cols ...string) ([]int64, error) {
+	return this.NewAction().SumInt(i, cols...)
+}
+
+func (this *DB) Avg(i interface{}, cols ...string) ([]float64, error) {
+	return this.NewAction().Avg(i, cols...)
+}
+
+func (this *DB) Min(i interface{}, cols ...string) ([]interface{}, error) {
+	return this.NewAction().Min(i, cols...)
+}
+
+func (this *DB) Max(i interface{}, cols ...string) ([]interface{}, error) {
+	return this.NewAction().Max(i, cols...)
+}
+
 /*
 
 
@@ -388,21 +487,32 @@ func (this *DB) tableName(table interface{}) (string, error) {
 	}
 }
 
+// lockTable 锁定表的写操作,返回解锁函数
+func (this *DB) lockTable(tableName string) func() {
+	v, _ := this.locks.LoadOrStore(tableName, &sync.Mutex{})
+	mu := v.(*sync.Mutex)
+	mu.Lock()
+	keep := this.keepOrder(tableName)
+	return func() {
+		keep()
+		mu.Unlock()
+	}
+}
+
 func (this *DB) filename(tableName string) string {
 	return filepath.Join(this.dir, tableName+".mini")
 }
 
-// getID 修改时间可能会有问题,主键变小了,后续改成记录最后的id,然后增加
+// getID 主键,按时间递增,时间回调时在最后的id上增加,插入前按表中最大的主键设置lastID(seedID)
 func (this *DB) getID() int64 {
 	this.mu.Lock()
 	defer this.mu.Unlock()
-	for {
-		id := time.Now().UnixNano()
-		if id != this.lastID { //是否改成不等于最后的id
-			this.lastID = id
-			return id
-		}
+	id := time.Now().UnixNano()
+	if id <= this.lastID {
+		id = this.lastID + 1
 	}
+	this.lastID = id
+	return id
 }
 
 type Field struct {
@@ -414,6 +524,23 @@ type Field struct {
 	Sort  int    //排序 序号
 }
 
+// Val 按类型转换后的值,int64,float64,bool,string
+func (this *Field) Val() interface{} {
+	if this == nil {
+		return nil
+	}
+	switch this.Type {
+	case Int:
+		return conv.Int64(this.Value)
+	case Float:
+		return conv.Float64(this.Value)
+	case Bool:
+		return conv.Bool(this.Value)
+	default:
+		return this.Value
+	}
+}
+
 func (this *Field) compare(Type string, value interface{}) bool {
 	if this == nil {
 		return false
@@ -1,7 +1,14 @@
 package minidb
 
 import (
+	"database/sql"
+	"fmt"
+	"github.com/injoyai/minidb/builder"
+	"github.com/injoyai/minidb/core"
+	"os"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestNew(t *testing.T) {
@@ -40,7 +47,7 @@ func TestNew(t *testing.T) {
 	}
 
 	t.Log("Delete")
-	err := db.Where("time=0").Delete(new(Person))
+	_, err := db.Where("time=0").Delete(new(Person))
 	if err != nil {
 		t.Error(err)
 		return
@@ -63,7 +70,7 @@ func TestNew(t *testing.T) {
 func TestDel(t *testing.T) {
 	db := New("./database/test")
 	t.Log("Delete")
-	err := db.Where("time<=1721890649352277600").Delete(new(Person))
+	_, err := db.Where("time<=1721890649352277600").Delete(new(Person))
 	if err != nil {
 		t.Error(err)
 		return
@@ -76,7 +83,7 @@ func TestUpdate(t *testing.T) {
 		WithTag("orm"),
 	)
 	t.Log("Update")
-	err := db.Where("time=1721890686324003000").Cols("id,name,age").Update(&Person{
+	_, err := db.Where("time=1721890686324003000").Cols("id,name,age").Update(&Person{
 		ID:   666,
 		Name: "小白4",
 		Age:  22,
@@ -275,3 +282,1416 @@ func TestLN(t *testing.T) {
 	}
 
 }
+
+// newTestDB 新建测试用的数据库,并清空之前的数据
+func newTestDB(t *testing.T, name string, ls ...*Person) *DB {
+	os.RemoveAll("./database/" + name)
+	db := New("./database/" + name)
+	if err := db.Sync(new(Person)); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range ls {
+		if err := db.Insert(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func TestWhereOr(t *testing.T) {
+	db := newTestDB(t, "testwhereor",
+		&Person{Name: "A", Age: 16, High: 170.1, Boy: true},
+		&Person{Name: "B", Age: 18, High: 160.2, Boy: false},
+		&Person{Name: "C", Age: 20, High: 180.3, Boy: true},
+		&Person{Name: "D", Age: 22, High: 150.4, Boy: false},
+	)
+	for _, v := range []struct {
+		where string
+		args  []interface{}
+		want  int64
+	}{
+		{"name=A or name=B", nil, 2},
+		{"(age>? and boy=true) or name=?", []interface{}{18, "A"}, 2},
+		{"not (age<18 or age>20)", nil, 2},
+		{"age>=18 and (high<160 or name='C')", nil, 2},
+		{"not boy=true and not (name=B)", nil, 1},
+		{"name=A or name=B and age>18", nil, 1},
+		{"(name=A or name=B) and (age=16 or age=22)", nil, 1},
+	} {
+		co, err := db.Where(v.where, v.args...).Count(new(Person))
+		if err != nil {
+			t.Error(v.where, err)
+			continue
+		}
+		if co != v.want {
+			t.Errorf("%s: 期望%d,得到%d", v.where, v.want, co)
+		}
+	}
+	for _, where := range []string{"(name=A", "name=A or", "name", "name='A"} {
+		if _, err := db.Where(where).Count(new(Person)); err == nil {
+			t.Errorf("%s: 期望错误", where)
+		}
+	}
+}
+
+func TestWhereIn(t *testing.T) {
+	db := newTestDB(t, "testwherein",
+		&Person{Name: "A", Age: 16, High: 170.1},
+		&Person{Name: "B", Age: 18, High: 160.2},
+		&Person{Name: "C", Age: 20, High: 180.3},
+		&Person{Name: "D", Age: 22, High: 150.4},
+	)
+	for _, v := range []struct {
+		where string
+		args  []interface{}
+		want  int64
+	}{
+		{"name in (?)", []interface{}{[]string{"A", "C", "E"}}, 2},
+		{"age in ?", []interface{}{[]int{16, 18}}, 2},
+		{"age in (16, ?, '22')", []interface{}{20}, 3},
+		{"name not in (A,B)", nil, 2},
+		{"high in (?)", []interface{}{[]float64{170.10, 150.4}}, 2},
+		{"age between ? and ?", []interface{}{18, 20}, 2},
+		{"age not between 18 and 20 and name!=D", nil, 1},
+		{"high between 150 and 165.5 or name in (A)", nil, 3},
+	} {
+		co, err := db.Where(v.where, v.args...).Count(new(Person))
+		if err != nil {
+			t.Error(v.where, err)
+			continue
+		}
+		if co != v.want {
+			t.Errorf("%s: 期望%d,得到%d", v.where, v.want, co)
+		}
+	}
+}
+
+func TestSort(t *testing.T) {
+	db := newTestDB(t, "testsort",
+		&Person{Name: "A", Age: 18, High: 170.1},
+		&Person{Name: "B", Age: 9, High: 160.2},
+		&Person{Name: "C", Age: 20, High: 80.3},
+		&Person{Name: "D", Age: 18, High: 150.4},
+		&Person{Name: "E", Age: 100, High: 150.4},
+	)
+	names := func(ls []*Person) (s string) {
+		for _, v := range ls {
+			s += v.Name
+		}
+		return
+	}
+	for _, v := range []struct {
+		action *Action
+		want   string
+	}{
+		{db.NewAction().Asc("age"), "BADCE"},
+		{db.NewAction().Desc("age"), "ECADB"},
+		{db.NewAction().Asc("high"), "CDEBA"},
+		{db.NewAction().Asc("age").Desc("high"), "BADCE"},
+		{db.NewAction().Desc("high").Desc("name"), "ABEDC"},
+		{db.NewAction().Asc("age").Desc("time").Limit(2), "BD"},
+		{db.NewAction().Asc("age").Limit(2, 1), "AD"},
+		{db.Where("age>=18").Desc("name").Limit(10, 2), "CA"},
+	} {
+		ls := []*Person(nil)
+		if err := v.action.Find(&ls); err != nil {
+			t.Error(err)
+			continue
+		}
+		if got := names(ls); got != v.want {
+			t.Errorf("期望%s,得到%s", v.want, got)
+		}
+	}
+	p := new(Person)
+	if has, err := db.Desc("age").Get(p); err != nil || !has || p.Name != "E" {
+		t.Error(has, err, p)
+	}
+	//排序字段不存在时返回错误
+	if err := db.Desc("nope").Find(&[]*Person{}); err == nil {
+		t.Error("排序字段不存在时期望错误")
+	}
+	if err := db.Table(new(Person)).GroupBy("age").Asc("name").Find(&[]map[string]string{}); err == nil {
+		t.Error("分组查询的排序字段不是分组字段时期望错误")
+	}
+	if err := db.Table(new(Person)).GroupBy("age").Desc("count").Asc("age").Find(&[]map[string]string{}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSortMerge(t *testing.T) {
+	os.RemoveAll("./database/testsortmerge")
+	db := New("./database/testsortmerge", WithMemory(300))
+	if err := db.Sync(new(Person)); err != nil {
+		t.Fatal(err)
+	}
+	ls := []*Person(nil)
+	for i := 0; i < 50; i++ {
+		ls = append(ls, &Person{Name: string(rune('A' + i%26)), Age: (i * 37) % 50, High: float64(i)})
+	}
+	if err := db.Insert(ls); err != nil {
+		t.Fatal(err)
+	}
+	result := []*Person(nil)
+	if err := db.Asc("name").Desc("age").Find(&result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 50 {
+		t.Fatalf("期望50条,得到%d条", len(result))
+	}
+	for i := 1; i < len(result); i++ {
+		a, b := result[i-1], result[i]
+		if a.Name > b.Name || (a.Name == b.Name && a.Age < b.Age) {
+			t.Errorf("排序错误: %v %v", *a, *b)
+		}
+	}
+	result = nil
+	if err := db.Where("age<10").Desc("high").Find(&result); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < len(result); i++ {
+		if result[i-1].High < result[i].High {
+			t.Errorf("排序错误: %v %v", *result[i-1], *result[i])
+		}
+	}
+	//前offset+size条超过内存上限时外部排序
+	result = nil
+	co, err := db.Asc("high").Limit(5, 40).FindAndCount(&result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if co != 50 || len(result) != 5 || result[0].High != 40 || result[4].High != 44 {
+		t.Error(co, len(result))
+	}
+	//临时文件需要被删除
+	es, _ := os.ReadDir("./database/testsortmerge")
+	if len(es) != 1 {
+		t.Errorf("临时文件未删除: %d", len(es))
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	db := newTestDB(t, "testaggregate",
+		&Person{Name: "A", Age: 9, High: 170.5, Boy: true},
+		&Person{Name: "B", Age: 10, High: 160.25},
+		&Person{Name: "C", Age: 100, High: 80.25, Boy: true},
+	)
+	sum, err := db.Sum(new(Person), "age", "high")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum[0] != 119 || sum[1] != 411 {
+		t.Error(sum)
+	}
+	avg, err := db.Where("boy=true").Avg(new(Person), "age", "high")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if avg[0] != 54.5 || avg[1] != 125.375 {
+		t.Error(avg)
+	}
+	//按类型比较,字符串比较时"9">"100"
+	min, err := db.Min(new(Person), "age", "high", "name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if min[0] != int64(9) || min[1] != 80.25 || min[2] != "A" {
+		t.Error(min)
+	}
+	max, err := db.Where("age>100").Max(new(Person), "age")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if max[0] != nil {
+		t.Error(max)
+	}
+	if _, err := db.Sum(new(Person), "name"); err == nil {
+		t.Error("字符串不能求和")
+	}
+	//主键超过2^53,按int64精确求和
+	list := []*Person(nil)
+	if err := db.Find(&list); err != nil {
+		t.Fatal(err)
+	}
+	total := int64(0)
+	for _, v := range list {
+		total += int64(v.ID)
+	}
+	if sums, err := db.SumInt(new(Person), "time", "age"); err != nil || sums[0] != total || sums[1] != 119 {
+		t.Error(sums, err, total)
+	}
+	if _, err := db.SumInt(new(Person), "high"); err == nil {
+		t.Error("Float字段不能使用SumInt")
+	}
+	if _, err := db.Max(new(Person), "nmae"); err == nil {
+		t.Error("字段不存在")
+	}
+}
+
+type PersonGroup struct {
+	Age   int     `orm:"age"`
+	Count int     `orm:"count"`
+	High  float64 `orm:"high"`
+	Last  string  `orm:"max(name)"`
+}
+
+func TestGroupBy(t *testing.T) {
+	db := newTestDB(t, "testgroupby",
+		&Person{Name: "A", Age: 18, High: 170.5},
+		&Person{Name: "B", Age: 20, High: 160},
+		&Person{Name: "C", Age: 18, High: 180.5},
+		&Person{Name: "D", Age: 9, High: 100},
+		&Person{Name: "E", Age: 20, High: 150},
+		&Person{Name: "F", Age: 18, High: 100},
+	)
+	ls := []*PersonGroup(nil)
+	err := db.Table(new(Person)).GroupBy("age").Cols("age,sum(high) as high,max(name)").Having("count>?", 1).Desc("count").Find(&ls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ls) != 2 {
+		t.Fatalf("期望2组,得到%d组", len(ls))
+	}
+	if *ls[0] != (PersonGroup{Age: 18, Count: 3, High: 451, Last: "F"}) || *ls[1] != (PersonGroup{Age: 20, Count: 2, High: 310, Last: "E"}) {
+		t.Error(*ls[0], *ls[1])
+	}
+
+	ls = nil
+	co, err := db.Table(new(Person)).Where("age<20").GroupBy("age").Asc("age").FindAndCount(&ls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if co != 2 || len(ls) != 2 || ls[0].Age != 9 || ls[0].Count != 1 || ls[1].Count != 3 {
+		t.Error(co, ls)
+	}
+
+	//没有分组字段时,整个表为一组
+	ls = nil
+	if err := db.Table(new(Person)).Cols("avg(age) as age").Find(&ls); err != nil {
+		t.Fatal(err)
+	}
+	if len(ls) != 1 || ls[0].Count != 6 || ls[0].Age != 17 {
+		t.Error(ls)
+	}
+
+	if err := db.Table(new(Person)).GroupBy("nmae").Find(&ls); err == nil {
+		t.Error("分组字段不存在")
+	}
+}
+
+func TestBuilder(t *testing.T) {
+	db := newTestDB(t, "testbuilder",
+		&Person{Name: "A and B", Age: 16, High: 170.1},
+		&Person{Name: "B", Age: 18, High: 160.2},
+		&Person{Name: "C", Age: 20, High: 180.3, Boy: true},
+		&Person{Name: "D's", Age: 22, High: 150.4},
+	)
+	for _, v := range []struct {
+		cond builder.Cond
+		want int64
+	}{
+		{builder.Eq("name", "A and B"), 1},
+		{builder.Eq("name", "D's").Or(builder.Lt("age", 18)), 2},
+		{builder.And(builder.Gte("age", 18), builder.Neq("name", "B")), 2},
+		{builder.Or(builder.And(builder.Gt("high", 160), builder.Lte("age", 18)), builder.Eq("boy", true)), 3},
+		{builder.Not(builder.In("age", []int{16, 18})), 2},
+		{builder.NotIn("name", "B", "C"), 2},
+		{builder.Between("high", 150, 170.1), 3},
+		{builder.Like("name", "and"), 1},
+		{builder.And(), 4},
+	} {
+		co, err := db.Where(v.cond).Count(new(Person))
+		if err != nil {
+			t.Error(v.cond, err)
+			continue
+		}
+		if co != v.want {
+			t.Errorf("%s: 期望%d,得到%d", v.cond, v.want, co)
+		}
+	}
+	for _, cond := range []builder.Cond{
+		builder.Eq("", 1),
+		builder.Eq("name = 1 or 1", 1),
+		builder.Eq("name", []int{1}),
+		builder.Gt("age", nil),
+		builder.In("age"),
+		builder.In("age", []int{}),
+		builder.And(builder.Eq("age", 1), builder.Like("or", "x")),
+		builder.Not(builder.Or()),
+	} {
+		if cond.Err == nil {
+			t.Errorf("%s: 期望错误", cond)
+		}
+		if _, err := db.Where(cond).Count(new(Person)); err == nil {
+			t.Errorf("%s: 期望错误", cond)
+		}
+	}
+}
+
+func TestWhereErr(t *testing.T) {
+	db := newTestDB(t, "testwhereerr",
+		&Person{Name: "A", Age: 16},
+		&Person{Name: "B", Age: 18},
+	)
+	for _, v := range []struct {
+		where string
+		args  []interface{}
+	}{
+		{"nmae ~ x", nil},
+		{"name", nil},
+		{"name=?", nil},
+		{"name=?", []interface{}{"A", "B"}},
+		{"age>18 and", nil},
+		{"nmae=A", nil},
+		{"name=A or (age>1 and nmae=B)", nil},
+		{"age in (1,2", nil},
+		{"age between 1 or 2", nil},
+	} {
+		//错误的条件不能删除数据
+		if _, err := db.Where(v.where, v.args...).Delete(new(Person)); err == nil {
+			t.Errorf("%s: 期望错误", v.where)
+		} else {
+			t.Log(err)
+		}
+		if _, err := db.Where(v.where, v.args...).Update(&Person{Name: "C"}); err == nil {
+			t.Errorf("%s: 期望错误", v.where)
+		}
+	}
+	if co, err := db.Count(new(Person)); err != nil || co != 2 {
+		t.Error(co, err)
+	}
+	if co, err := db.Where("name=C").Count(new(Person)); err != nil || co != 0 {
+		t.Error(co, err)
+	}
+	//临时文件不能残留
+	es, _ := os.ReadDir("./database/testwhereerr")
+	if len(es) != 1 {
+		t.Errorf("临时文件未删除: %d", len(es))
+	}
+}
+
+type Quota struct {
+	ID    int     `orm:"time"`
+	Name  string  `orm:"name"`
+	Used  int     `orm:"used"`
+	Quota int     `orm:"quota"`
+	Start int     `orm:"start_time"`
+	End   int     `orm:"end_time"`
+	Rate  float64 `orm:"rate"`
+}
+
+func TestWhereExpr(t *testing.T) {
+	os.RemoveAll("./database/testwhereexpr")
+	db := New("./database/testwhereexpr")
+	if err := db.Sync(new(Quota)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Insert(
+		&Quota{Name: "A", Used: 9, Quota: 10, Start: 100, End: 200, Rate: 0.5},
+		&Quota{Name: "B", Used: 11, Quota: 10, Start: 100, End: 105, Rate: 1.5},
+		&Quota{Name: "C", Used: 100, Quota: 20, Start: 50, End: 1000, Rate: 2},
+		&Quota{Name: "quota", Used: 5, Quota: 5, Start: 0, End: 0, Rate: 0},
+	); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []struct {
+		where string
+		args  []interface{}
+		want  int64
+	}{
+		//按Int比较,字符串比较时"9">"10"
+		{"used > quota", nil, 2},
+		{"used <= quota", nil, 2},
+		{"used = quota", nil, 1},
+		{"end_time - start_time > ?", []interface{}{50}, 2},
+		{"(end_time - start_time) / 2 >= 50", nil, 2},
+		{"used * rate > quota", nil, 2},
+		{"used - quota * 2 > 0 or name='quota'", nil, 2},
+		{"(used + 1) * 2 <= quota * 2", nil, 1},
+		{"quota < used / 2", nil, 1},
+		//存在该字段时为字段,加引号为值
+		{"name = quota", nil, 0},
+		{"name = 'quota'", nil, 1},
+		{"10 < used", nil, 2},
+	} {
+		co, err := db.Where(v.where, v.args...).Count(new(Quota))
+		if err != nil {
+			t.Error(v.where, err)
+			continue
+		}
+		if co != v.want {
+			t.Errorf("%s: 期望%d,得到%d", v.where, v.want, co)
+		}
+	}
+	for _, where := range []string{"used + nmae > 1", "name + 1 > 1", "used / start_time > 1", "used + > 1"} {
+		if _, err := db.Where(where).Count(new(Quota)); err == nil {
+			t.Errorf("%s: 期望错误", where)
+		}
+	}
+}
+
+func TestWhereLike(t *testing.T) {
+	db := newTestDB(t, "testwherelike",
+		&Person{Name: "abc"},
+		&Person{Name: "abcd"},
+		&Person{Name: "xabc"},
+		&Person{Name: "a%c"},
+		&Person{Name: "a_c"},
+		&Person{Name: "小米\n手机"},
+	)
+	for _, v := range []struct {
+		where string
+		args  []interface{}
+		want  int64
+	}{
+		{"name like 'abc%'", nil, 2},
+		{"name like '%abc'", nil, 2},
+		{"name like '%abc%'", nil, 3},
+		{"name like abc", nil, 1},
+		{"name like 'a_c'", nil, 3},
+		{"name like 'a\\%c'", nil, 1},
+		{"name like 'a!_c' escape '!'", nil, 1},
+		{"name not like ?", []interface{}{"a%"}, 2},
+		{"name like '小米%'", nil, 1},
+		{"name regexp '^a.c$'", nil, 3},
+		{"name regexp ? and name not regexp 'd$'", []interface{}{"^x?abc"}, 2},
+	} {
+		co, err := db.Where(v.where, v.args...).Count(new(Person))
+		if err != nil {
+			t.Error(v.where, err)
+			continue
+		}
+		if co != v.want {
+			t.Errorf("%s: 期望%d,得到%d", v.where, v.want, co)
+		}
+	}
+	if co, err := db.NewAction().Like("name", "%").Count(new(Person)); err != nil || co != 1 {
+		t.Error("Like", co, err)
+	}
+	if co, err := db.Where(builder.Like("name", "_")).Count(new(Person)); err != nil || co != 1 {
+		t.Error("builder.Like", co, err)
+	}
+	for _, where := range []string{"name regexp '('", "name like 'a\\'", "name like 'a' escape 'ab'"} {
+		if _, err := db.Where(where).Count(new(Person)); err == nil {
+			t.Errorf("%s: 期望错误", where)
+		}
+	}
+
+	//同一个Action中,规则只编译一次
+	a := db.Where("name like 'a%' or name regexp 'c$'")
+	if _, err := a.Count(new(Person)); err != nil {
+		t.Fatal(err)
+	}
+	if len(a.patterns) != 2 {
+		t.Error(len(a.patterns))
+	}
+}
+
+func TestSQL(t *testing.T) {
+	db := newTestDB(t, "testsql")
+	if _, err := db.Exec("INSERT INTO Person (name, age, high, boy) VALUES (?, ?, 170.5, true), ('B', 20, ?, false)", "A", 18, 160.5); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("insert into Person (name, age) values ('C', 9);"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("UPDATE Person SET age = ?, high = 100 WHERE name = ?", 21, "B"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("UPDATE Person SET age = 1"); err == nil {
+		t.Error("修改需要条件")
+	}
+
+	ls, err := db.Query("SELECT name, age FROM Person WHERE age > ? ORDER BY time DESC LIMIT 10", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ls) != 2 || ls[0]["name"] != "B" || ls[0]["age"] != int64(21) || ls[1]["name"] != "A" || len(ls[0]) != 2 {
+		t.Error(ls)
+	}
+
+	ls, err = db.Query("select * from Person where name in (?) order by age limit 1, 1", []string{"A", "C"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ls) != 1 || ls[0]["name"] != "A" || ls[0]["high"] != 170.5 || ls[0]["boy"] != true {
+		t.Error(ls)
+	}
+
+	ls, err = db.Query("SELECT boy, count(*) AS total, max(age) FROM Person GROUP BY boy HAVING count > ? ORDER BY total DESC LIMIT 5 OFFSET 0", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ls) != 2 || ls[0]["boy"] != false || ls[0]["total"] != int64(2) || ls[0]["max(age)"] != int64(21) {
+		t.Error(ls)
+	}
+
+	if _, err := db.Exec("DELETE FROM Person WHERE age < 10 or name = 'A'"); err != nil {
+		t.Fatal(err)
+	}
+	ls, err = db.Query("SELECT name FROM Person")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ls) != 1 || ls[0]["name"] != "B" {
+		t.Error(ls)
+	}
+	ls, err = db.Query("SELECT name AS n, age FROM Person")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ls) != 1 || len(ls[0]) != 2 || ls[0]["n"] != "B" {
+		t.Error(ls)
+	}
+
+	for _, sql := range []string{
+		"SELECT nmae FROM Person",
+		"SELECT * FROM Person ORDER BY nope DESC LIMIT 2",
+		"SELECT name n FROM Person",
+		"SELECT FROM Person",
+		"SELECT * Person",
+		"SELECT * FROM Person WHERE nmae = 1",
+		"SELECT * FROM Person LIMIT",
+		"SELECT * FROM Person WHERE age > ?",
+		"DROP TABLE Person",
+		"INSERT INTO Person (name) VALUES (1, 2)",
+		"UPDATE Person SET name WHERE age = 1",
+		"SELECT * FROM Nothing",
+	} {
+		if _, err := db.Query(sql); err == nil {
+			t.Errorf("%s: 期望错误", sql)
+		}
+	}
+	//修改的字段不存在或为主键时返回错误,不修改数据
+	for _, sql := range []string{
+		"UPDATE Person SET age = 1, nope = 1 WHERE name = 'B'",
+		"UPDATE Person SET time = 1 WHERE name = 'B'",
+	} {
+		if co, err := db.Exec(sql); err == nil || co != 0 {
+			t.Errorf("%s: 期望错误,得到(%d)", sql, co)
+		}
+	}
+	if co, err := db.Table(new(Person)).Where("name=?", "B").Update(map[string]interface{}{"nmae": "X"}); err == nil || co != 0 {
+		t.Error(co, err)
+	}
+}
+
+func TestDriver(t *testing.T) {
+	newTestDB(t, "testdriver")
+	db, err := sql.Open("minidb", "./database/testdriver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	result, err := db.Exec("INSERT INTO Person (name, age, high, boy) VALUES (?, ?, ?, ?), ('B', 20, 160.5, false)", "A", 18, 170.5, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := result.RowsAffected(); err != nil || n != 2 {
+		t.Error(n, err)
+	}
+
+	rows, err := db.Query("SELECT name, age, high, boy FROM Person WHERE name in ? ORDER BY age", []string{"A", "B"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ls := []Person(nil)
+	for rows.Next() {
+		p := Person{}
+		if err := rows.Scan(&p.Name, &p.Age, &p.High, &p.Boy); err != nil {
+			t.Fatal(err)
+		}
+		ls = append(ls, p)
+	}
+	if err := rows.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(ls) != 2 || ls[0].Name != "A" || ls[0].Age != 18 || ls[0].High != 170.5 || !ls[0].Boy || ls[1].Boy {
+		t.Error(ls)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec("DELETE FROM Person WHERE name = ?", "A"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	tx, err = db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec("UPDATE Person SET age = ? WHERE name = ?", 30, "B"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	//语句出错时已执行的语句也恢复
+	tx, err = db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec("DELETE FROM Person WHERE name = ?", "A"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec("UPDATE Person SET nope = 1 WHERE name = ?", "B"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err == nil {
+		t.Error("期望错误")
+	}
+	if es, _ := os.ReadDir("./database/testdriver"); len(es) != 1 {
+		t.Errorf("备份文件未删除: %d", len(es))
+	}
+
+	total, age := 0, 0
+	if err := db.QueryRow("SELECT count(*), max(age) FROM Person").Scan(&total, &age); err != nil {
+		t.Fatal(err)
+	}
+	if total != 2 || age != 30 {
+		t.Error(total, age)
+	}
+	name := ""
+	if err := db.QueryRow("SELECT name AS n FROM Person WHERE age = ?", 30).Scan(&name); err != nil || name != "B" {
+		t.Error(name, err)
+	}
+
+	if _, err := db.Query("SELECT * FROM Nothing"); err == nil {
+		t.Error("期望错误")
+	}
+}
+
+func TestIterate(t *testing.T) {
+	db := newTestDB(t, "testiterate",
+		&Person{Name: "A", Age: 16},
+		&Person{Name: "B", Age: 18},
+		&Person{Name: "C", Age: 20},
+	)
+	names := ""
+	if err := db.Where("age>?", 16).Desc("age").Iterate(new(Person), func(i int, bean interface{}) error {
+		names += bean.(*Person).Name
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if names != "CB" {
+		t.Error(names)
+	}
+
+	rows, err := db.Rows(new(Person))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ls := []*Person(nil)
+	for rows.Next() {
+		p := new(Person)
+		if err := rows.Scan(p); err != nil {
+			t.Fatal(err)
+		}
+		ls = append(ls, p)
+		if len(ls) == 2 {
+			break
+		}
+	}
+	if err := rows.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(ls) != 2 || ls[0].Name != "A" || ls[1].Age != 18 || rows.Next() {
+		t.Error(ls)
+	}
+
+	//关闭后可以再次读取文件
+	if err := db.Insert(&Person{Name: "D"}); err != nil {
+		t.Fatal(err)
+	}
+	rows, err = db.Table(new(Person)).Where("nmae=?", "A").Rows(new(Person))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	if rows.Next() || rows.Err() == nil {
+		t.Error("期望错误")
+	}
+}
+
+func TestLimit(t *testing.T) {
+	ls := []*Person(nil)
+	for i := 0; i < 20; i++ {
+		ls = append(ls, &Person{Name: string(rune('A' + i)), Age: i})
+	}
+	db := newTestDB(t, "testlimit", ls...)
+
+	//偏移按符合条件的数据计算
+	result := []*Person(nil)
+	if err := db.Where("age>?", 9).Limit(3, 2).Find(&result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 3 || result[0].Age != 12 || result[2].Age != 14 {
+		t.Error(result)
+	}
+	if err := db.Where("age>?", 9).Limit(-1, 8).Find(&result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 2 || result[0].Age != 18 {
+		t.Error(result)
+	}
+
+	//按主键分页
+	ids := []int(nil)
+	after := int64(0)
+	for {
+		page := []*Person(nil)
+		if err := db.Where("age<?", 15).After(after).Limit(4).Find(&page); err != nil {
+			t.Fatal(err)
+		}
+		if len(page) == 0 {
+			break
+		}
+		for _, v := range page {
+			ids = append(ids, v.Age)
+		}
+		after = int64(page[len(page)-1].ID)
+	}
+	if len(ids) != 15 || ids[0] != 0 || ids[14] != 14 {
+		t.Error(ids)
+	}
+	if co, err := db.After(int64(ls[17].ID)).Count(new(Person)); err != nil || co != 2 {
+		t.Error(co, err)
+	}
+
+	//修改和删除也按符合条件的数据分页
+	if _, err := db.Table(new(Person)).Where("age>?", 9).Limit(2, 1).Update(map[string]interface{}{"name": "X"}); err != nil {
+		t.Fatal(err)
+	}
+	if co, err := db.Where("name=?", "X").Count(new(Person)); err != nil || co != 2 {
+		t.Error(co, err)
+	}
+	if _, err := db.Where("name=?", "X").Limit(1).Delete(new(Person)); err != nil {
+		t.Fatal(err)
+	}
+	if co, err := db.Count(new(Person)); err != nil || co != 19 {
+		t.Error(co, err)
+	}
+}
+
+func TestPage(t *testing.T) {
+	ls := []*Person(nil)
+	for i := 0; i < 25; i++ {
+		ls = append(ls, &Person{Name: string(rune('A' + i)), Age: i, Boy: i%2 == 0})
+	}
+	db := newTestDB(t, "testpage", ls...)
+
+	result := []*Person(nil)
+	page, err := db.Where("age>?", 2).Page(&result, 3, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 22 || page.Pages != 3 || page.HasNext || len(result) != 2 || result[0].Age != 23 {
+		t.Error(page, result)
+	}
+
+	page, err = db.Desc("age").Page(&result, 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 25 || page.Pages != 3 || !page.HasNext || len(result) != 10 || result[0].Age != 24 {
+		t.Error(page, result)
+	}
+
+	groups := []*PersonGroup(nil)
+	page, err = db.Table(new(Person)).GroupBy("boy").Page(&groups, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 2 || !page.HasNext || len(groups) != 1 {
+		t.Error(page, groups)
+	}
+
+	co, err := db.Where("age<?", 5).Limit(2).FindAndCount(&result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if co != 5 || len(result) != 2 {
+		t.Error(co, result)
+	}
+
+	if _, err := db.Page(&result, 1, 0); err == nil {
+		t.Error("期望错误")
+	}
+}
+
+func TestPluck(t *testing.T) {
+	db := newTestDB(t, "testpluck",
+		&Person{Name: "A", Age: 16, Boy: true},
+		&Person{Name: "B", Age: 18},
+		&Person{Name: "A", Age: 20, Boy: true},
+		&Person{Name: "C", Age: 18},
+	)
+
+	if has, err := db.Where("name=?", "C").Exist(new(Person)); err != nil || !has {
+		t.Error(has, err)
+	}
+	if has, err := db.Where("age>?", 20).Exist(new(Person)); err != nil || has {
+		t.Error(has, err)
+	}
+
+	ages := []int(nil)
+	if err := db.Table(new(Person)).Where("name!=?", "B").Asc("age").Pluck("age", &ages); err != nil {
+		t.Fatal(err)
+	}
+	if len(ages) != 3 || ages[0] != 16 || ages[2] != 20 {
+		t.Error(ages)
+	}
+	if err := db.NewAction().Pluck("age", &ages); err == nil {
+		t.Error("期望错误")
+	}
+	if err := db.Table(new(Person)).Pluck("nmae", &ages); err == nil {
+		t.Error("期望错误")
+	}
+	if err := db.Table(new(Person)).Where("name ~ ?", "A").Pluck("age", &ages); err == nil {
+		t.Error("条件错误时期望错误")
+	}
+	if err := db.Table(new(Person)).Cols("name").Pluck("age", &ages); err == nil {
+		t.Error("字段不在查询的字段中时期望错误")
+	}
+
+	result := []*Person(nil)
+	if err := db.Distinct("name").Find(&result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 3 || result[0].Name != "A" || result[0].Age != 0 || result[2].Name != "C" {
+		t.Error(result)
+	}
+	if co, err := db.Distinct("age, boy").Count(new(Person)); err != nil || co != 3 {
+		t.Error(co, err)
+	}
+	names := []string(nil)
+	if err := db.Table(new(Person)).Distinct("boy").Pluck("boy", &names); err != nil || len(names) != 2 {
+		t.Error(names, err)
+	}
+	//去重在筛选条件之后,与调用顺序无关
+	if err := db.Table(new(Person)).Distinct("name").Where("age>?", 16).Pluck("name", &names); err != nil || len(names) != 3 {
+		t.Error(names, err)
+	}
+}
+
+type Device struct {
+	ID   int    `orm:"time"`
+	Name string `orm:"name"`
+}
+
+type DeviceLog struct {
+	ID       int    `orm:"time"`
+	DeviceID int    `orm:"device_id"`
+	Msg      string `orm:"msg"`
+}
+
+type DeviceLogJoin struct {
+	Msg  string `orm:"DeviceLog.msg"`
+	Name string `orm:"Device.name"`
+}
+
+func TestJoin(t *testing.T) {
+	for _, memory := range []int{1 << 20, 1} {
+		os.RemoveAll("./database/testjoin")
+		db := New("./database/testjoin", WithMemory(memory))
+		if err := db.Sync(new(Device), new(DeviceLog)); err != nil {
+			t.Fatal(err)
+		}
+		devices := []*Device{{Name: "A"}, {Name: "B"}, {Name: "C"}}
+		if err := db.Insert(devices[0], devices[1], devices[2]); err != nil {
+			t.Fatal(err)
+		}
+		for i, v := range []int{0, 1, 0, -1, 1} {
+			log := &DeviceLog{Msg: string(rune('a' + i))}
+			if v >= 0 {
+				log.DeviceID = devices[v].ID
+			}
+			if err := db.Insert(log); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		result := []*DeviceLogJoin(nil)
+		if err := db.Table("DeviceLog").Join("Device", "DeviceLog.device_id = Device.time").
+			Where("Device.name=?", "A").Asc("DeviceLog.msg").Find(&result); err != nil {
+			t.Fatal(err)
+		}
+		if len(result) != 2 || result[0].Msg != "a" || result[0].Name != "A" || result[1].Msg != "c" {
+			t.Error(memory, result)
+		}
+
+		if err := db.Table("DeviceLog").LeftJoin("Device", "Device.time = DeviceLog.device_id").
+			Asc("DeviceLog.msg").Find(&result); err != nil {
+			t.Fatal(err)
+		}
+		if len(result) != 5 || result[3].Msg != "d" || result[3].Name != "" || result[4].Name != "B" {
+			t.Error(memory, result)
+		}
+
+		//主表较小时用主表建立哈希表
+		if err := db.Table("Device").LeftJoin("DeviceLog", "DeviceLog.device_id = Device.time").
+			Asc("Device.name").Find(&result); err != nil {
+			t.Fatal(err)
+		}
+		if len(result) != 5 || result[0].Name != "A" || result[4].Name != "C" || result[4].Msg != "" {
+			t.Error(memory, result)
+		}
+
+		//左关联关联不到的数据,关联表的字段为空值,可以用于筛选
+		if err := db.Table("DeviceLog").LeftJoin("Device", "Device.time = DeviceLog.device_id").
+			Where("Device.name=? or DeviceLog.msg=?", "A", "d").Asc("DeviceLog.msg").Find(&result); err != nil {
+			t.Fatal(err)
+		}
+		if len(result) != 3 || result[0].Msg != "a" || result[1].Msg != "c" || result[2].Msg != "d" || result[2].Name != "" {
+			t.Error(memory, result)
+		}
+		if co, err := db.Table("Device").LeftJoin("DeviceLog", "DeviceLog.device_id = Device.time").
+			Where("DeviceLog.msg=? or Device.name=?", "a", "C").Count(); err != nil || co != 2 {
+			t.Error(memory, co, err)
+		}
+		if co, err := db.Table("DeviceLog").LeftJoin("Device", "Device.time = DeviceLog.device_id").
+			GroupBy("Device.name").Having("Device.name!=?", "A").Count(); err != nil || co != 2 {
+			t.Error(memory, co, err)
+		}
+
+		if co, err := db.Table("Device").Join("DeviceLog", "DeviceLog.device_id = Device.time").Count(); err != nil || co != 4 {
+			t.Error(memory, co, err)
+		}
+		if co, err := db.Table("Device").Join("DeviceLog", "DeviceLog.device_id = Device.time").
+			GroupBy("Device.name").Count(); err != nil || co != 2 {
+			t.Error(memory, co, err)
+		}
+	}
+
+	db := New("./database/testjoin")
+	for _, a := range []*Action{
+		db.Table("DeviceLog").Join("Device", "device_id = time"),
+		db.Table("DeviceLog").Join("Device", "DeviceLog.device = Device.time"),
+		db.Table("DeviceLog").Join("Device", "DeviceLog.device_id = Device.time").Where("name=?", "A"),
+		db.Table("DeviceLog").Join("Nothing", "DeviceLog.device_id = Nothing.time"),
+	} {
+		if _, err := a.Count(); err == nil {
+			t.Error("期望错误")
+		}
+	}
+	if _, err := db.Table("DeviceLog").Join("Device", "DeviceLog.device_id = Device.time").Delete(); err == nil {
+		t.Error("期望错误")
+	}
+}
+
+func TestSubquery(t *testing.T) {
+	os.RemoveAll("./database/testsubquery")
+	db := New("./database/testsubquery")
+	if err := db.Sync(new(Device), new(DeviceLog)); err != nil {
+		t.Fatal(err)
+	}
+	devices := []*Device{{Name: "A"}, {Name: "B"}, {Name: "C"}}
+	if err := db.Insert(devices[0], devices[1], devices[2]); err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range []int{0, 1, 0, 2} {
+		if err := db.Insert(&DeviceLog{DeviceID: devices[v].ID, Msg: string(rune('a' + i))}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result := []*DeviceLog(nil)
+	query := db.Table("Device").Where("name in (?)", []string{"A", "C"}).Cols("time")
+	if err := db.Where("device_id in ? and msg!=?", query, "a").Find(&result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 2 || result[0].Msg != "c" || result[1].Msg != "d" {
+		t.Error(result)
+	}
+	if co, err := db.Table(new(DeviceLog)).Where("device_id not in (?)", db.Table("Device").Where("name=?", "A").Cols("time")).Count(); err != nil || co != 2 {
+		t.Error(co, err)
+	}
+
+	if co, err := db.Table(new(DeviceLog)).Where("exists ?", db.Table("Device").Where("name=?", "C")).Count(); err != nil || co != 4 {
+		t.Error(co, err)
+	}
+	if co, err := db.Table(new(DeviceLog)).Where("msg=? or not exists ?", "a", db.Table("Device").Where("name=?", "C")).Count(); err != nil || co != 1 {
+		t.Error(co, err)
+	}
+
+	for _, v := range []struct {
+		where string
+		args  []interface{}
+	}{
+		{"device_id in ?", []interface{}{db.Table("Device")}},
+		{"device_id in ?", []interface{}{db.Table("Nothing").Cols("time")}},
+		{"exists ?", []interface{}{1}},
+		{"exists", nil},
+	} {
+		if _, err := db.Table(new(DeviceLog)).Where(v.where, v.args...).Count(); err == nil {
+			t.Errorf("%s: 期望错误", v.where)
+		}
+	}
+	//子查询的条件错误时返回错误,不能视为全部符合
+	if _, err := db.Table(new(DeviceLog)).Where("device_id in ?", db.Table("Device").Where("name ~ ?", "A").Cols("time")).Count(); err == nil {
+		t.Error("子查询条件错误时期望错误")
+	}
+}
+
+func TestWhereBean(t *testing.T) {
+	db := newTestDB(t, "testwherebean",
+		&Person{Name: "小米", Age: 18, Boy: true},
+		&Person{Name: "小米", Age: 20},
+		&Person{Name: "小红", Age: 18},
+	)
+
+	result := []*Person(nil)
+	if err := db.Find(&result, &Person{Name: "小米", Age: 18}); err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 1 || !result[0].Boy {
+		t.Error(result)
+	}
+	//零值字段不作为条件
+	if err := db.Find(&result, Person{Age: 18}); err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 2 {
+		t.Error(result)
+	}
+	//map的零值也作为条件
+	if co, err := db.Where(map[string]interface{}{"name": "小米", "boy": false}).Count(new(Person)); err != nil || co != 1 {
+		t.Error(co, err)
+	}
+	p := new(Person)
+	if has, err := db.Get(p, map[string]string{"name": "小红"}); err != nil || !has || p.Age != 18 {
+		t.Error(p, has, err)
+	}
+	if err := db.Find(&result, map[string]interface{}{"nmae": "小米"}); err == nil {
+		t.Error("期望错误")
+	}
+	if err := db.Find(&result, 1); err == nil {
+		t.Error("期望错误")
+	}
+}
+
+func TestWhereFunc(t *testing.T) {
+	db := newTestDB(t, "testwherefunc",
+		&Person{Name: "A", Age: 16},
+		&Person{Name: "BB", Age: 18},
+		&Person{Name: "CCC", Age: 20},
+	)
+	long := func(row map[string]*Field) bool { return len(row["name"].Value) > 1 }
+
+	result := []*Person(nil)
+	if err := db.WhereFunc(long).Where("age<?", 20).Find(&result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 1 || result[0].Name != "BB" {
+		t.Error(result)
+	}
+	adult := func(bean interface{}) bool { return bean.(*Person).Age >= 18 }
+	if co, err := db.WhereBean(new(Person), adult).Count(new(Person)); err != nil || co != 2 {
+		t.Error(co, err)
+	}
+
+	//修改和删除也使用自定义条件
+	if _, err := db.WhereBean(new(Person), adult).Update(&Person{Name: "X"}); err != nil {
+		t.Fatal(err)
+	}
+	if co, err := db.Where("name=?", "X").Count(new(Person)); err != nil || co != 2 {
+		t.Error(co, err)
+	}
+	if _, err := db.WhereFunc(func(row map[string]*Field) bool { return row["age"].Value == "16" }).Delete(new(Person)); err != nil {
+		t.Fatal(err)
+	}
+	if co, err := db.Count(new(Person)); err != nil || co != 2 {
+		t.Error(co, err)
+	}
+	if err := db.WhereBean(Person{}, adult).Find(&result); err == nil {
+		t.Error("期望错误")
+	}
+}
+
+func TestInsertOrUpdate(t *testing.T) {
+	db := newTestDB(t, "testinsertorupdate", &Person{Name: "A", Age: 16})
+
+	p := &Person{Name: "B", Age: 18}
+	if inserted, err := db.InsertOrUpdate(p); err != nil || !inserted || p.ID == 0 {
+		t.Error(inserted, err, p)
+	}
+	id := p.ID
+	p.Age = 20
+	if inserted, err := db.InsertOrUpdate(p); err != nil || inserted || p.ID != id {
+		t.Error(inserted, err, p)
+	}
+	if inserted, err := db.InsertOrUpdate(&Person{Name: "A", Age: 30}, "name"); err != nil || inserted {
+		t.Error(inserted, err)
+	}
+	if inserted, err := db.InsertOrUpdate(&Person{Name: "C", Age: 40}, "name"); err != nil || !inserted {
+		t.Error(inserted, err)
+	}
+
+	result := []*Person(nil)
+	if err := db.Asc("age").Find(&result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 3 || result[0].Name != "B" || result[0].ID != id || result[1].Age != 30 || result[2].Name != "C" {
+		t.Error(result)
+	}
+	if _, err := db.InsertOrUpdate(&Person{Name: "D"}, "nmae"); err == nil {
+		t.Error("期望错误")
+	}
+}
+
+func TestAffected(t *testing.T) {
+	db := newTestDB(t, "testaffected",
+		&Person{Name: "A", Age: 16},
+		&Person{Name: "B", Age: 18},
+		&Person{Name: "C", Age: 20},
+	)
+	if co, err := db.Where("age>=?", 18).Update(&Person{Name: "X"}); err != nil || co != 2 {
+		t.Error(co, err)
+	}
+	if co, err := db.Where("name=?", "Y").Update(&Person{Name: "Z"}); err != nil || co != 0 {
+		t.Error(co, err)
+	}
+	if co, err := db.Where("name=?", "X").Limit(1).Delete(new(Person)); err != nil || co != 1 {
+		t.Error(co, err)
+	}
+	if co, err := db.Exec("DELETE FROM Person WHERE name = ?", "A"); err != nil || co != 1 {
+		t.Error(co, err)
+	}
+
+	db = New("./database/testaffected", WithAffectedErr(true))
+	if co, err := db.Where("name=?", "Y").Delete(new(Person)); err != ErrNotAffected || co != 0 {
+		t.Error(co, err)
+	}
+	if co, err := db.Where("name=?", "X").Update(&Person{Age: 1}); err != nil || co != 1 {
+		t.Error(co, err)
+	}
+
+	sqlDB, err := sql.Open("minidb", "./database/testaffected")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlDB.Close()
+	result, err := sqlDB.Exec("UPDATE Person SET age = ? WHERE age = ?", 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if co, err := result.RowsAffected(); err != nil || co != 1 {
+		t.Error(co, err)
+	}
+}
+
+func TestIncr(t *testing.T) {
+	db := newTestDB(t, "testincr",
+		&Person{Name: "A", Age: 16, High: 170},
+		&Person{Name: "B", Age: 18, High: 180},
+	)
+	if co, err := db.Where("name=?", "A").Incr("age").Update(new(Person)); err != nil || co != 1 {
+		t.Fatal(co, err)
+	}
+	if _, err := db.Where("age>?", 0).Decr("age", 2).Incr("high", 0.5).Update(&Person{Boy: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Where("name=?", "B").SetExpr("age", "age * ? + high", 2).Update(new(Person)); err != nil {
+		t.Fatal(err)
+	}
+	list := []*Person(nil)
+	if err := db.Asc("name").Find(&list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 ||
+		list[0].Age != 15 || list[0].High != 170.5 || !list[0].Boy || list[0].Name != "A" ||
+		list[1].Age != 212 || list[1].High != 180.5 || !list[1].Boy {
+		for _, v := range list {
+			t.Errorf("%#v", v)
+		}
+	}
+	if _, err := db.Where("name=?", "A").Incr("unknown").Update(new(Person)); err == nil {
+		t.Error("字段不存在应返回错误")
+	}
+	if _, err := db.Where("name=?", "A").SetExpr("age", "age +").Update(new(Person)); err == nil {
+		t.Error("表达式错误应返回错误")
+	}
+	if _, err := db.Where("name=?", "A").Incr("time").Update(new(Person)); err == nil {
+		t.Error("主键不能修改")
+	}
+}
+
+func TestUpdateCols(t *testing.T) {
+	db := newTestDB(t, "testupdatecols",
+		&Person{Name: "A", Age: 16, High: 170, Boy: true},
+	)
+	get := func() *Person {
+		p := new(Person)
+		if _, err := db.Get(p); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	//默认不修改零值
+	if _, err := db.Where("name=?", "A").Update(&Person{Age: 17}); err != nil {
+		t.Fatal(err)
+	}
+	if p := get(); p.Name != "A" || p.Age != 17 || p.High != 170 || !p.Boy {
+		t.Errorf("%#v", p)
+	}
+	if _, err := db.Where("name=?", "A").MustCols("boy").Update(&Person{High: 171}); err != nil {
+		t.Fatal(err)
+	}
+	if p := get(); p.Name != "A" || p.Age != 17 || p.High != 171 || p.Boy {
+		t.Errorf("%#v", p)
+	}
+	if _, err := db.Where("name=?", "A").Cols("age").Update(&Person{Name: "B"}); err != nil {
+		t.Fatal(err)
+	}
+	if p := get(); p.Name != "A" || p.Age != 0 || p.High != 171 {
+		t.Errorf("%#v", p)
+	}
+	if _, err := db.Where("name=?", "A").Omit("name").Update(&Person{Name: "B", Age: 18}); err != nil {
+		t.Fatal(err)
+	}
+	if p := get(); p.Name != "A" || p.Age != 18 {
+		t.Errorf("%#v", p)
+	}
+	if _, err := db.Where("name=?", "A").AllCols().Omit("name").Update(&Person{High: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if p := get(); p.Name != "A" || p.Age != 0 || p.High != 1 {
+		t.Errorf("%#v", p)
+	}
+
+	//查询的字段,排除的字段可以用于筛选
+	list := []map[string]string(nil)
+	if err := db.Table(new(Person)).Cols("name").Where("age=?", 0).Find(&list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || len(list[0]) != 1 || list[0]["name"] != "A" {
+		t.Error(list)
+	}
+	list = nil
+	if err := db.Table(new(Person)).Omit("boy,high").Asc("high").Find(&list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || len(list[0]) != 3 || list[0]["age"] != "0" {
+		t.Error(list)
+	}
+}
+
+type Job struct {
+	ID    int    `orm:"id"`
+	Name  string `orm:"name"`
+	Retry int    `orm:"retry"`
+}
+
+func TestActionID(t *testing.T) {
+	os.RemoveAll("./database/testactionid")
+	db := New("./database/testactionid", WithID("id"))
+	if err := db.Sync(new(Job)); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []string{"A", "B", "C", "D", "E"} {
+		if err := db.Insert(&Job{Name: v}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	list := []*Job(nil)
+	if err := db.Asc("id").Find(&list); err != nil || len(list) != 5 {
+		t.Fatal(len(list), err)
+	}
+
+	job := new(Job)
+	if has, err := db.NewAction().ID(list[2].ID).Get(job); err != nil || !has || job.Name != "C" {
+		t.Error(has, err, job)
+	}
+	found := []*Job(nil)
+	if err := db.NewAction().ID(list[3].ID, list[1].ID, 1).Find(&found); err != nil || len(found) != 2 ||
+		found[0].Name != "B" || found[1].Name != "D" {
+		t.Error(err, found)
+	}
+	if has, err := db.NewAction().ID(list[4].ID + 1).Get(new(Job)); err != nil || has {
+		t.Error(has, err)
+	}
+	if co, err := db.NewAction().ID(list[0].ID).Incr("retry").Update(new(Job)); err != nil || co != 1 {
+		t.Error(co, err)
+	}
+	if co, err := db.NewAction().ID(list[1].ID, list[2].ID).Delete(new(Job)); err != nil || co != 2 {
+		t.Error(co, err)
+	}
+	found = nil
+	if err := db.Asc("id").Find(&found); err != nil || len(found) != 3 ||
+		found[0].Retry != 1 || found[1].Name != "D" {
+		t.Error(err, found)
+	}
+	if _, err := db.NewAction().ID().Delete(new(Job)); err == nil {
+		t.Error("主键为空应返回错误")
+	}
+
+	//主键无序时(例时钟回拨后写入)遍历全部数据
+	rewriteTable(t, db, "Job", func(rows [][]byte) [][]byte {
+		return [][]byte{rows[2], rows[0], rows[1]}
+	})
+	for _, v := range found {
+		job := new(Job)
+		if has, err := db.NewAction().ID(v.ID).Get(job); err != nil || !has || job.Name != v.Name {
+			t.Error(has, err, v.Name)
+		}
+	}
+}
+
+// rewriteTable 直接改写表文件的数据,模拟其他程序写入或时钟回拨
+func rewriteTable(t *testing.T, db *DB, tableName string, fn func(rows [][]byte) [][]byte) {
+	file := core.NewFile(db.filename(tableName))
+	file.OnOpen(func(s *core.Scanner) ([][]byte, error) { return s.LimitBytes(12) })
+	rows := [][]byte(nil)
+	err := file.UpdateWith(func(i int, bs []byte) ([][]byte, error) {
+		rows = append(rows, append([]byte(nil), bs...))
+		return nil, nil
+	}, func() ([][]byte, error) {
+		return fn(rows), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAfterUnordered(t *testing.T) {
+	ls := []*Person{{Name: "A"}, {Name: "B"}, {Name: "C"}}
+	db := newTestDB(t, "testafterunordered", ls...)
+	if co, err := db.After(int64(ls[0].ID)).Count(new(Person)); err != nil || co != 2 {
+		t.Error(co, err)
+	}
+	//主键倒序,二分查找会漏掉数据,需要遍历全部数据
+	rewriteTable(t, db, "Person", func(rows [][]byte) [][]byte {
+		return [][]byte{rows[2], rows[1], rows[0]}
+	})
+	for _, db := range []*DB{db, New("./database/testafterunordered")} {
+		if co, err := db.After(int64(ls[0].ID)).Count(new(Person)); err != nil || co != 2 {
+			t.Error(co, err)
+		}
+		if co, err := db.After(int64(ls[1].ID)).Count(new(Person)); err != nil || co != 1 {
+			t.Error(co, err)
+		}
+	}
+
+	//已有的主键大于当前时间(时钟回拨),新的主键仍然更大
+	future := int64(ls[2].ID) + int64(time.Hour)
+	rewriteTable(t, db, "Person", func(rows [][]byte) [][]byte {
+		c := strings.Replace(string(rows[0]), fmt.Sprint(ls[2].ID), fmt.Sprint(future), 1)
+		return [][]byte{rows[2], rows[1], []byte(c)}
+	})
+	db = New("./database/testafterunordered")
+	p := &Person{Name: "D"}
+	if err := db.Insert(p); err != nil {
+		t.Fatal(err)
+	}
+	if int64(p.ID) <= future {
+		t.Errorf("主键(%d)需要大于已有的主键(%d)", p.ID, future)
+	}
+	if co, err := db.After(future).Count(new(Person)); err != nil || co != 1 {
+		t.Error(co, err)
+	}
+}
@@ -0,0 +1,275 @@
+package minidb
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+/*
+Driver database/sql的驱动,数据源为数据库目录,例:
+
+	db, err := sql.Open("minidb", "./data/database")
+	rows, err := db.Query("SELECT name, age FROM Person WHERE age > ?", 18)
+
+语句同DB.Query和DB.Exec,值按表头的类型转换成int64,float64,bool,string,查询结果逐条从文件读取
+事务见tx
+*/
+type Driver struct {
+	mu sync.Mutex
+	db map[string]*DB //同一个目录共用一个DB,保证生成的id不重复
+}
+
+func init() {
+	sql.Register("minidb", &Driver{})
+}
+
+// Open 打开连接,name为数据库目录
+func (this *Driver) Open(name string) (driver.Conn, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if this.db == nil {
+		this.db = make(map[string]*DB)
+	}
+	db, ok := this.db[name]
+	if !ok {
+		db = New(name)
+		this.db[name] = db
+	}
+	return &conn{db: db}, nil
+}
+
+// conn 连接,实现driver.Conn
+type conn struct {
+	db *DB
+	tx *tx //进行中的事务
+}
+
+func (this *conn) Prepare(query string) (driver.Stmt, error) {
+	return &stmt{conn: this, query: query}, nil
+}
+
+func (this *conn) Close() error {
+	this.tx = nil
+	return nil
+}
+
+func (this *conn) Begin() (driver.Tx, error) {
+	if this.tx != nil {
+		return nil, errors.New("事务已开启")
+	}
+	this.tx = &tx{conn: this}
+	return this.tx, nil
+}
+
+// CheckNamedValue 切片参数原样传递,用于 in ? ,其他参数按默认方式转换
+func (this *conn) CheckNamedValue(v *driver.NamedValue) error {
+	if v.Value != nil {
+		switch reflect.ValueOf(v.Value).Kind() {
+		case reflect.Slice, reflect.Array:
+			if _, ok := v.Value.([]byte); !ok {
+				return nil
+			}
+		}
+	}
+	return driver.ErrSkip
+}
+
+// stmt 语句,实现driver.Stmt,每次执行时编译,参数数量在编译时校验
+type stmt struct {
+	conn  *conn
+	query string
+}
+
+func (this *stmt) Close() error { return nil }
+
+func (this *stmt) NumInput() int { return -1 }
+
+func (this *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	s, err := this.conn.db.prepare(this.query, values(args)...)
+	if err != nil {
+		return nil, err
+	}
+	if s.Type == sqlSelect {
+		return nil, fmt.Errorf("Exec不支持SELECT语句: %s", this.query)
+	}
+	if this.conn.tx != nil {
+		this.conn.tx.stmts = append(this.conn.tx.stmts, s)
+		return &result{err: errors.New("事务中的语句在Commit时执行,无法获取影响的行数")}, nil
+	}
+	co, err := s.exec()
+	if err != nil {
+		return nil, err
+	}
+	return &result{affected: co}, nil
+}
+
+func (this *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	s, err := this.conn.db.prepare(this.query, values(args)...)
+	if err != nil {
+		return nil, err
+	}
+	if s.Type != sqlSelect {
+		return nil, fmt.Errorf("Query只支持SELECT语句: %s", this.query)
+	}
+	r, err := s.Action.Rows(nil)
+	if err != nil {
+		return nil, err
+	}
+	//先读取第一条数据,打开文件后才有表头,表不存在等错误在这里返回
+	if !r.Next() {
+		if err := r.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return &rows{stmt: s, columns: s.columns(), rows: r, first: true}, nil
+}
+
+func values(args []driver.Value) []interface{} {
+	ls := make([]interface{}, len(args))
+	for i, v := range args {
+		ls[i] = v
+	}
+	return ls
+}
+
+// result 执行结果,实现driver.Result
+type result struct {
+	affected int64
+	err      error
+}
+
+func (this *result) LastInsertId() (int64, error) {
+	return 0, errors.New("不支持LastInsertId")
+}
+
+func (this *result) RowsAffected() (int64, error) {
+	return this.affected, this.err
+}
+
+// rows 查询结果,实现driver.Rows,逐条从文件读取
+type rows struct {
+	stmt    *statement
+	columns []string
+	rows    *Rows
+	first   bool //第一条数据已在Query时读取
+}
+
+func (this *rows) Columns() []string { return this.columns }
+
+func (this *rows) Close() error { return this.rows.Close() }
+
+// Next 值按表头的类型转换,Int为int64,Float为float64,Bool为bool,String为string,没有值的字段为nil
+func (this *rows) Next(dest []driver.Value) error {
+	if this.first {
+		this.first = false
+	} else {
+		this.rows.Next()
+	}
+	if this.rows.end {
+		if err := this.rows.Err(); err != nil {
+			return err
+		}
+		return io.EOF
+	}
+	for i, col := range this.columns {
+		dest[i] = this.rows.field[this.stmt.source(col)].Val()
+	}
+	return nil
+}
+
+/*
+tx 事务,实现driver.Tx
+
+INSERT,UPDATE,DELETE在Commit时执行,Rollback时丢弃,事务中的查询读取的是已提交的数据,看不到事务中的修改,
+Commit时锁定涉及的表(同一个DB的其他写操作等待),备份表文件后按顺序执行,
+任意语句出错时全部表恢复到执行前的文件,全部成功后删除备份,
+执行过程中其他查询可能读取到部分执行的结果,进程在执行过程中退出时不能恢复
+*/
+type tx struct {
+	conn  *conn
+	stmts []*statement //待执行的语句
+}
+
+// Commit 执行事务中的语句,出错时恢复涉及的表
+func (this *tx) Commit() (err error) {
+	this.conn.tx = nil
+	if len(this.stmts) == 0 {
+		return nil
+	}
+
+	//按表名顺序锁定,避免和其他事务互相等待
+	names := []string(nil)
+	for _, s := range this.stmts {
+		if !inCols(names, s.Action.TableName) {
+			names = append(names, s.Action.TableName)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		defer this.conn.db.lockTable(name)()
+	}
+
+	//备份表文件,出错时恢复
+	backups := make(map[string]string)
+	defer func() {
+		for filename, backup := range backups {
+			if err != nil {
+				os.Rename(backup, filename)
+			} else {
+				os.Remove(backup)
+			}
+		}
+	}()
+	for _, name := range names {
+		filename := this.conn.db.filename(name)
+		backup, err := backupFile(filename)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return fmt.Errorf("表(%s)不存在", name)
+			}
+			return err
+		}
+		backups[filename] = backup
+	}
+
+	for _, s := range this.stmts {
+		s.Action.locked = true
+		if _, err := s.exec(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rollback 丢弃事务中的语句
+func (this *tx) Rollback() error {
+	this.conn.tx = nil
+	return nil
+}
+
+// backupFile 复制文件到同目录,返回备份的文件名
+func backupFile(filename string) (string, error) {
+	src, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	backup := filename + ".tx"
+	dst, err := os.Create(backup)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		os.Remove(backup)
+		return "", err
+	}
+	return backup, dst.Close()
+}
@@ -0,0 +1,198 @@
+package minidb
+
+import (
+	"errors"
+	"fmt"
+	"github.com/injoyai/conv"
+	"strconv"
+)
+
+/*
+表达式,条件比较的两边,例:
+	used > quota
+	end_time - start_time > ?
+	(high - 100) * 2 >= age
+运算符 + - * / 需要用空格隔开,例 a - b ,未隔开的 a-b 视为一个值
+*/
+
+// expr 表达式,计算得到一个值,类型按表头中字段的类型
+type expr interface {
+	eval(field map[string]*Field) (*Field, error)
+	keys() []string //表达式中使用的字段,用于校验字段是否存在
+}
+
+// exprField 字段,例 age
+type exprField string
+
+func (this exprField) eval(field map[string]*Field) (*Field, error) {
+	val, ok := field[string(this)]
+	if !ok {
+		return nil, fmt.Errorf("字段(%s)不存在", string(this))
+	}
+	return val, nil
+}
+
+func (this exprField) keys() []string { return []string{string(this)} }
+
+// exprValue 值,例 '小米' , 18 , ?
+type exprValue string
+
+func (this exprValue) eval(field map[string]*Field) (*Field, error) {
+	return &Field{Value: string(this)}, nil
+}
+
+func (this exprValue) keys() []string { return nil }
+
+// exprWord 未加引号的词,存在该字段时为字段,否则为值,例 name=小米 , used>quota
+type exprWord string
+
+func (this exprWord) eval(field map[string]*Field) (*Field, error) {
+	if val, ok := field[string(this)]; ok {
+		return val, nil
+	}
+	return &Field{Value: string(this)}, nil
+}
+
+func (this exprWord) keys() []string { return nil }
+
+// exprCalc 四则运算,例 end_time - start_time
+type exprCalc struct {
+	Op    string //运算符 + - * /
+	Left  expr
+	Right expr
+}
+
+func (this *exprCalc) eval(field map[string]*Field) (*Field, error) {
+	left, err := this.Left.eval(field)
+	if err != nil {
+		return nil, err
+	}
+	right, err := this.Right.eval(field)
+	if err != nil {
+		return nil, err
+	}
+	leftType, err := numberType(left)
+	if err != nil {
+		return nil, err
+	}
+	rightType, err := numberType(right)
+	if err != nil {
+		return nil, err
+	}
+
+	//都是整数时按整数运算,除法按浮点运算
+	if leftType == Int && rightType == Int && this.Op != "/" {
+		a, _ := strconv.ParseInt(left.Value, 10, 64)
+		b, _ := strconv.ParseInt(right.Value, 10, 64)
+		result := int64(0)
+		switch this.Op {
+		case "+":
+			result = a + b
+		case "-":
+			result = a - b
+		case "*":
+			result = a * b
+		}
+		return &Field{Type: Int, Value: strconv.FormatInt(result, 10)}, nil
+	}
+
+	a, _ := strconv.ParseFloat(left.Value, 64)
+	b, _ := strconv.ParseFloat(right.Value, 64)
+	result := float64(0)
+	switch this.Op {
+	case "+":
+		result = a + b
+	case "-":
+		result = a - b
+	case "*":
+		result = a * b
+	case "/":
+		if b == 0 {
+			return nil, errors.New("除数不能为0")
+		}
+		result = a / b
+	}
+	return &Field{Type: Float, Value: strconv.FormatFloat(result, 'f', -1, 64)}, nil
+}
+
+// newCalc 新建运算,参与运算的词不是数字时都视为字段
+func newCalc(op string, left, right expr) *exprCalc {
+	this := &exprCalc{Op: op, Left: left, Right: right}
+	for _, e := range []*expr{&this.Left, &this.Right} {
+		if word, ok := (*e).(exprWord); ok {
+			if _, err := strconv.ParseFloat(string(word), 64); err == nil {
+				*e = exprValue(word)
+			} else {
+				*e = exprField(word)
+			}
+		}
+	}
+	return this
+}
+
+func (this *exprCalc) keys() []string {
+	return append(this.Left.keys(), this.Right.keys()...)
+}
+
+// numberType 参与运算的值的类型,字段按表头的类型,值按内容判断
+func numberType(f *Field) (string, error) {
+	switch f.Type {
+	case Int, Float:
+		if len(f.Value) == 0 {
+			//未赋值的字段视为0
+			f = &Field{Name: f.Name, Type: f.Type, Value: "0"}
+		}
+		if _, err := strconv.ParseFloat(f.Value, 64); err != nil {
+			return "", fmt.Errorf("字段(%s)的值(%s)不是数字", f.Name, f.Value)
+		}
+		if f.Type == Int {
+			if _, err := strconv.ParseInt(f.Value, 10, 64); err != nil {
+				return Float, nil
+			}
+		}
+		return f.Type, nil
+	case "":
+		if _, err := strconv.ParseInt(f.Value, 10, 64); err == nil {
+			return Int, nil
+		}
+		if _, err := strconv.ParseFloat(f.Value, 64); err == nil {
+			return Float, nil
+		}
+		return "", fmt.Errorf("值(%s)不是数字", f.Value)
+	default:
+		return "", fmt.Errorf("字段(%s)类型(%s)不支持运算", f.Name, f.Type)
+	}
+}
+
+// compareExpr 比较两边的值,类型以字段的类型为准,例 used>quota
+func compareExpr(left *Field, Type string, right *Field) bool {
+	if len(left.Type) == 0 && len(right.Type) > 0 {
+		left = &Field{Name: left.Name, Type: right.Type, Value: left.Value}
+	}
+	return left.compare(Type, right.Value)
+}
+
+// convertType 按字段的类型转换表达式的结果,例 Int字段的结果为浮点时取整数部分
+func convertType(Type string, f *Field) (string, error) {
+	switch Type {
+	case Int:
+		if f.Type == Int {
+			return f.Value, nil
+		}
+		v, err := strconv.ParseFloat(f.Value, 64)
+		if err != nil {
+			return "", fmt.Errorf("值(%s)不是数字", f.Value)
+		}
+		return strconv.FormatInt(int64(v), 10), nil
+	case Float:
+		v, err := strconv.ParseFloat(f.Value, 64)
+		if err != nil {
+			return "", fmt.Errorf("值(%s)不是数字", f.Value)
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case Bool:
+		return strconv.FormatBool(conv.Bool(f.Value)), nil
+	default:
+		return f.Value, nil
+	}
+}
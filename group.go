@@ -0,0 +1,151 @@
+package minidb
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/injoyai/conv"
+	"regexp"
+	"strings"
+)
+
+// regAggregate 聚合字段,例 count(*) , sum(bytes) as total
+var regAggregate = regexp.MustCompile(`(?i)^(\w+)\s*\(\s*([^()\s]+)\s*\)(?:\s+(?:as\s+)?(\S+))?$`)
+
+// parseAggregate 解析聚合字段,不是聚合字段返回nil
+func parseAggregate(s string) *aggregate {
+	ls := regAggregate.FindStringSubmatch(strings.TrimSpace(s))
+	if ls == nil {
+		return nil
+	}
+	agg := newAggregate(strings.ToLower(ls[1]), ls[2])
+	if len(ls[3]) > 0 {
+		agg.As = ls[3]
+	}
+	return agg
+}
+
+// GroupBy 分组,每组返回一条数据,包括分组的字段,数量count及Cols中的聚合字段
+// 例 GroupBy("level").Cols("level,max(time) as last").Having("count>?",10)
+func (this *Action) GroupBy(cols ...string) *Action {
+	for _, s := range cols {
+		for _, v := range strings.Split(s, ",") {
+			if v = strings.TrimSpace(v); len(v) > 0 {
+				this.groups = append(this.groups, v)
+				this.checks = append(this.checks, checkCol(v))
+			}
+		}
+	}
+	return this
+}
+
+// Having 分组后的筛选条件,语法同Where,字段为分组的字段,count及聚合字段
+func (this *Action) Having(s string, args ...interface{}) *Action {
+	if this.Err != nil || len(strings.TrimSpace(s)) == 0 {
+		return this
+	}
+	c, err := parseWhere(this.patterns, s, args...)
+	if err != nil {
+		this.Err = err
+		return this
+	}
+	this.having = append(this.having, c.mate)
+	return this
+}
+
+// checkCol 校验字段是否在表头中
+func checkCol(col string) func(t *Table) error {
+	return func(t *Table) error {
+		if _, ok := t.Fields.Map()[col]; !ok {
+			return fmt.Errorf("字段(%s)不存在", col)
+		}
+		return nil
+	}
+}
+
+// grouped 是否是分组查询,设置了GroupBy或者Cols中有聚合字段
+func (this *Action) grouped() bool {
+	return len(this.groups) > 0 || len(this.aggregates) > 0
+}
+
+// fieldKey 多个字段的值组成的key,按类型转换后比较,例 bool的空值和false相同
+func (this *Action) fieldKey(field map[string]*Field, cols []string) string {
+	key := [][]byte(nil)
+	for _, col := range cols {
+		if val, ok := field[col]; ok {
+			key = append(key, []byte(conv.String(val.Val())))
+		} else {
+			key = append(key, nil)
+		}
+	}
+	return string(bytes.Join(key, this.db.split))
+}
+
+// group 一组数据
+type group struct {
+	Field      map[string]*Field //分组字段的值
+	count      *aggregate        //数量
+	aggregates []*aggregate      //聚合字段
+}
+
+// rangeGroup 遍历分组后的数据,按每组第一次出现的顺序
+func (this *Action) rangeGroup(fn func(field map[string]*Field) (bool, error)) error {
+	groups := []*group(nil)
+	mGroup := make(map[string]*group)
+	err := this.rangeMate(func(field map[string]*Field) (bool, error) {
+		key := this.fieldKey(field, this.groups)
+		g, ok := mGroup[key]
+		if !ok {
+			g = &group{
+				Field: make(map[string]*Field),
+				count: newAggregate(aggCount, "*"),
+			}
+			g.count.As = aggCount
+			for _, col := range this.groups {
+				if val, ok := field[col]; ok {
+					g.Field[col] = val
+				}
+			}
+			for _, v := range this.aggregates {
+				agg := newAggregate(v.Func, v.Key)
+				agg.As = v.As
+				g.aggregates = append(g.aggregates, agg)
+			}
+			mGroup[key] = g
+			groups = append(groups, g)
+		}
+		g.count.add(field)
+		for _, agg := range g.aggregates {
+			agg.add(field)
+		}
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, g := range groups {
+		field := g.Field
+		field[g.count.As] = g.count.Field()
+		for _, agg := range g.aggregates {
+			if val := agg.Field(); val != nil {
+				field[agg.As] = val
+			}
+		}
+		mate := true
+		for _, having := range this.having {
+			if ok, err := having(field); err != nil {
+				return err
+			} else if !ok {
+				mate = false
+				break
+			}
+		}
+		if !mate {
+			continue
+		}
+		if next, err := fn(field); err != nil || !next {
+			return err
+		}
+	}
+	return nil
+}
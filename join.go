@@ -0,0 +1,294 @@
+package minidb
+
+import (
+	"fmt"
+	"github.com/injoyai/conv"
+	"github.com/injoyai/minidb/core"
+	"os"
+	"strings"
+)
+
+/*
+关联查询,字段名称都带上表名,例:
+
+	db.Table("DeviceLog").Join("Device", "DeviceLog.device_id = Device.time").Where("Device.name=?", "A").Find(&rows)
+
+哈希关联,用较小的表建立哈希表(左关联时为关联的表),
+超过内存上限(WithMemory)时分段建立,每段遍历一次另一边的数据
+*/
+
+const (
+	joinInner = "inner"
+	joinLeft  = "left"
+)
+
+// join 关联的表
+type join struct {
+	Type    string     //关联类型 inner,left
+	Name    string     //关联的表名
+	Left    string     //已关联数据的字段,例 DeviceLog.device_id
+	Right   string     //关联表的字段,例 Device.time
+	scanner *core.File //关联表的文件
+	table   *Table     //关联表的表头,字段名称带表名
+}
+
+// Join 内关联,只保留两边都有的数据,例 Join("Device", "DeviceLog.device_id = Device.time")
+func (this *Action) Join(table interface{}, on string) *Action {
+	return this.join(joinInner, table, on)
+}
+
+// LeftJoin 左关联,保留左边全部数据,关联不到的字段为空
+func (this *Action) LeftJoin(table interface{}, on string) *Action {
+	return this.join(joinLeft, table, on)
+}
+
+func (this *Action) join(Type string, table interface{}, on string) *Action {
+	if this.Err != nil {
+		return this
+	}
+	name, err := this.db.tableName(table)
+	if err != nil {
+		this.Err = err
+		return this
+	}
+	ls := strings.Split(on, "=")
+	if len(ls) != 2 {
+		this.Err = fmt.Errorf("关联条件(%s)格式错误,例 A.id = B.id", on)
+		return this
+	}
+	j := &join{
+		Type:    Type,
+		Name:    name,
+		Left:    strings.TrimSpace(ls[0]),
+		Right:   strings.TrimSpace(ls[1]),
+		scanner: core.NewFile(this.db.filename(name), 0),
+	}
+	if !strings.HasPrefix(j.Right, name+".") {
+		j.Left, j.Right = j.Right, j.Left
+	}
+	if !strings.HasPrefix(j.Right, name+".") {
+		this.Err = fmt.Errorf("关联条件(%s)需要包含表(%s)的字段", on, name)
+		return this
+	}
+	j.scanner.OnOpen(func(s *core.Scanner) ([][]byte, error) {
+		ls, err := s.LimitBytes(12)
+		if err != nil {
+			return nil, err
+		}
+		t, err := this.db.DecodeTable(ls)
+		if err != nil {
+			return nil, err
+		}
+		j.table = t.qualify(name)
+		return ls, nil
+	})
+	this.joins = append(this.joins, j)
+	this.checks = append(this.checks, checkCol(j.Left), checkCol(j.Right))
+	return this
+}
+
+// qualify 字段名称带上表名,例 Device.name
+func (this *Table) qualify(name string) *Table {
+	t := &Table{Name: name}
+	for _, f := range this.Fields {
+		field := *f
+		field.Name = name + "." + f.Name
+		t.Fields = append(t.Fields, &field)
+	}
+	return t
+}
+
+// setJoined 读取关联表的表头,合并成查询数据的表头,主表的字段名称带上表名
+func (this *Action) setJoined() error {
+	this.table = this.table.qualify(this.TableName)
+	joined := &Table{Name: this.TableName}
+	for _, f := range this.table.Fields {
+		field := *f
+		joined.Fields = append(joined.Fields, &field)
+	}
+	offset := len(this.table.Fields)
+	for _, j := range this.joins {
+		if j.table == nil {
+			if err := j.scanner.WithScanner(func(f *os.File, p [][]byte, s *core.Scanner) error { return nil }); err != nil {
+				return err
+			}
+		}
+		for _, f := range j.table.Fields {
+			field := *f
+			field.Index += offset
+			joined.Fields = append(joined.Fields, &field)
+		}
+		offset += len(j.table.Fields)
+	}
+	this.joined = joined
+	return nil
+}
+
+// header 查询数据的表头,关联查询时为全部关联表的字段
+func (this *Action) header() *Table {
+	if this.joined != nil {
+		return this.joined
+	}
+	return this.table
+}
+
+// rangeJoin 遍历主表关联前n个表后的数据
+func (this *Action) rangeJoin(n int, fn func(field map[string]*Field) (bool, error)) error {
+	j := this.joins[n-1]
+	left := func(fn func(field map[string]*Field) (bool, error)) error {
+		if n == 1 {
+			return this.withScanner(func(f *os.File, p [][]byte, s *core.Scanner) error {
+				return this.table.DecodeData(s, this.db.split, func(index int, field map[string]*Field) (bool, error) {
+					return fn(field)
+				})
+			})
+		}
+		return this.rangeJoin(n-1, fn)
+	}
+	right := func(fn func(field map[string]*Field) (bool, error)) error {
+		return j.scanner.WithScanner(func(f *os.File, p [][]byte, s *core.Scanner) error {
+			return j.table.DecodeData(s, this.db.split, func(index int, field map[string]*Field) (bool, error) {
+				return fn(field)
+			})
+		})
+	}
+	//左关联时关联不到的数据,关联表的字段为空值,筛选条件可以使用这些字段,打开文件后才有表头
+	var fields map[string]*Field
+	null := func() map[string]*Field {
+		if fields == nil {
+			fields = make(map[string]*Field, len(j.table.Fields))
+			for _, f := range j.table.Fields {
+				fields[f.Name] = &Field{Index: f.Index, Name: f.Name, Type: f.Type, Memo: f.Memo, Sort: f.Sort}
+			}
+		}
+		return fields
+	}
+	//第一个关联时比较两个表的大小,用较小的表建立哈希表,之后用关联的表建立哈希表
+	if n == 1 && fileSize(this.scanner.Filename) < fileSize(j.scanner.Filename) {
+		return this.hashJoin(left, j.Left, j.Type == joinLeft, right, j.Right, false, null, fn)
+	}
+	return this.hashJoin(right, j.Right, false, left, j.Left, j.Type == joinLeft, null, fn)
+}
+
+// hashJoin 哈希关联,build建立哈希表,probe逐条查找,keep为是否保留关联不到的数据,关联不到的一边为null
+// build超过内存上限时分段建立,每段遍历一次probe,probe关联不到的数据在最后一段时返回
+func (this *Action) hashJoin(
+	build func(fn func(field map[string]*Field) (bool, error)) error, buildKey string, buildKeep bool,
+	probe func(fn func(field map[string]*Field) (bool, error)) error, probeKey string, probeKeep bool,
+	null func() map[string]*Field, fn func(field map[string]*Field) (bool, error),
+) error {
+	stop := false
+	emit := func(a, b map[string]*Field) (bool, error) {
+		if a == nil {
+			a = null()
+		}
+		if b == nil {
+			b = null()
+		}
+		field := make(map[string]*Field, len(a)+len(b))
+		for k, v := range a {
+			field[k] = v
+		}
+		for k, v := range b {
+			field[k] = v
+		}
+		next, err := fn(field)
+		stop = err != nil || !next
+		return next, err
+	}
+
+	probeMatched := []bool(nil) //probe每条数据是否关联到,分多段时使用
+	for start := 0; ; {
+		rows := []map[string]*Field(nil)
+		hash := make(map[string][]int)
+		index, memory, done, first := 0, 0, true, start == 0
+		err := build(func(field map[string]*Field) (bool, error) {
+			if index < start {
+				index++
+				return true, nil
+			}
+			if memory >= this.db.memory {
+				done = false
+				return false, nil
+			}
+			index++
+			memory += fieldSize(field)
+			rows = append(rows, field)
+			if key, ok := joinKey(field, buildKey); ok {
+				hash[key] = append(hash[key], len(rows)-1)
+			}
+			return true, nil
+		})
+		if err != nil {
+			return err
+		}
+		start = index
+
+		buildMatched := make([]bool, len(rows))
+		probeIndex := 0
+		err = probe(func(field map[string]*Field) (bool, error) {
+			i := probeIndex
+			probeIndex++
+			ls := []int(nil)
+			if key, ok := joinKey(field, probeKey); ok {
+				ls = hash[key]
+			}
+			for _, b := range ls {
+				buildMatched[b] = true
+				if next, err := emit(rows[b], field); err != nil || !next {
+					return false, err
+				}
+			}
+			if !probeKeep {
+				return true, nil
+			}
+			if done && first {
+				//只有一段
+				if len(ls) == 0 {
+					return emit(nil, field)
+				}
+				return true, nil
+			}
+			if i >= len(probeMatched) {
+				probeMatched = append(probeMatched, false)
+			}
+			probeMatched[i] = probeMatched[i] || len(ls) > 0
+			if done && !probeMatched[i] {
+				return emit(nil, field)
+			}
+			return true, nil
+		})
+		if err != nil || stop {
+			return err
+		}
+		if buildKeep {
+			for b, row := range rows {
+				if !buildMatched[b] {
+					if next, err := emit(row, nil); err != nil || !next {
+						return err
+					}
+				}
+			}
+		}
+		if done {
+			return nil
+		}
+	}
+}
+
+// joinKey 关联字段的值,按类型转换,空值不参与关联
+func joinKey(field map[string]*Field, key string) (string, bool) {
+	val, ok := field[key]
+	if !ok || len(val.Value) == 0 {
+		return "", false
+	}
+	return conv.String(val.Val()), true
+}
+
+func fileSize(filename string) int64 {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
@@ -0,0 +1,110 @@
+package minidb
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// patternCacheSize 缓存的最大数量,超过则清空,避免字段比较时缓存无限增长
+const patternCacheSize = 256
+
+// patterns 编译后的like和regexp,每个Action一个,避免每行数据重复编译
+type patterns map[string]*regexp.Regexp
+
+// like 编译like,%匹配任意个字符,_匹配一个字符,escape为转义字符
+func (this patterns) like(pattern string, escape rune) (*regexp.Regexp, error) {
+	key := "like" + string(escape) + pattern
+	if re, ok := this[key]; ok {
+		return re, nil
+	}
+	s := strings.Builder{}
+	s.WriteString("(?s)^")
+	rs := []rune(pattern)
+	for i := 0; i < len(rs); i++ {
+		switch {
+		case rs[i] == escape:
+			if i++; i >= len(rs) {
+				return nil, fmt.Errorf("like(%s)转义字符(%s)后缺少字符", pattern, string(escape))
+			}
+			s.WriteString(regexp.QuoteMeta(string(rs[i])))
+		case rs[i] == '%':
+			s.WriteString(".*")
+		case rs[i] == '_':
+			s.WriteString(".")
+		default:
+			s.WriteString(regexp.QuoteMeta(string(rs[i])))
+		}
+	}
+	s.WriteString("$")
+	re, err := regexp.Compile(s.String())
+	if err != nil {
+		return nil, err
+	}
+	this.set(key, re)
+	return re, nil
+}
+
+// regexp 编译正则
+func (this patterns) regexp(pattern string) (*regexp.Regexp, error) {
+	key := "regexp" + pattern
+	if re, ok := this[key]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("regexp(%s)错误: %v", pattern, err)
+	}
+	this.set(key, re)
+	return re, nil
+}
+
+func (this patterns) set(key string, re *regexp.Regexp) {
+	if len(this) >= patternCacheSize {
+		for k := range this {
+			delete(this, k)
+		}
+	}
+	this[key] = re
+}
+
+// escapeLike 转义like中的通配符,用于包含查询
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// condMatch 模糊匹配,例 name like '小%' , name regexp '^小.$'
+type condMatch struct {
+	Left     expr     //左边的表达式
+	Right    expr     //匹配规则
+	Regexp   bool     //是否是正则,否则为like
+	Escape   rune     //like的转义字符
+	patterns patterns //编译缓存
+}
+
+func (this *condMatch) compile(pattern string) (*regexp.Regexp, error) {
+	if this.Regexp {
+		return this.patterns.regexp(pattern)
+	}
+	return this.patterns.like(pattern, this.Escape)
+}
+
+func (this *condMatch) mate(field map[string]*Field) (bool, error) {
+	left, err := this.Left.eval(field)
+	if err != nil {
+		return false, err
+	}
+	right, err := this.Right.eval(field)
+	if err != nil {
+		return false, err
+	}
+	re, err := this.compile(right.Value)
+	if err != nil {
+		return false, err
+	}
+	return re.MatchString(left.Value), nil
+}
+
+func (this *condMatch) keys() []string {
+	return append(this.Left.keys(), this.Right.keys()...)
+}
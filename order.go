@@ -0,0 +1,127 @@
+package minidb
+
+import (
+	"bytes"
+	"github.com/injoyai/conv"
+	"github.com/injoyai/minidb/core"
+	"os"
+)
+
+/*
+主键顺序,After和ID通过二分查找定位数据,需要表中的主键递增
+
+主键按时间生成,第一次插入前按表中最大的主键设置lastID,时钟回拨(例没有实时时钟的设备重启后)时新的主键仍然更大,
+其他方式写入的数据(例旧版本,其他程序)不能保证有序,查询前遍历一次表校验,结果缓存到文件变化,
+无序时改为遍历全部数据
+*/
+
+// order 表的主键顺序
+type order struct {
+	info    os.FileInfo //校验时的文件信息
+	ordered bool        //主键是否递增
+	max     int64       //最大的主键
+}
+
+// fresh 文件是否未变化,修改时间的精度可能较低,同时比较文件(修改数据时会替换文件)和大小
+func (this *order) fresh(info os.FileInfo) bool {
+	return os.SameFile(this.info, info) && this.info.Size() == info.Size() && this.info.ModTime().Equal(info.ModTime())
+}
+
+// tableOrder 表的主键顺序,文件变化后重新遍历校验
+func (this *DB) tableOrder(tableName string) (*order, error) {
+	filename := this.filename(tableName)
+	info, err := os.Stat(filename)
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := this.orders.Load(tableName); ok && v.(*order).fresh(info) {
+		return v.(*order), nil
+	}
+
+	o := &order{info: info, ordered: true}
+	index := -1
+	file := core.NewFile(filename, 0)
+	file.OnOpen(func(s *core.Scanner) ([][]byte, error) {
+		ls, err := s.LimitBytes(12)
+		if err != nil {
+			return nil, err
+		}
+		t, err := this.DecodeTable(ls)
+		if err != nil {
+			return nil, err
+		}
+		if f, ok := t.Fields.Map()[this.id]; ok {
+			index = f.Index
+		}
+		return ls, nil
+	})
+	first := true
+	err = file.Range(func(i int, bs []byte) bool {
+		if len(bs) == 0 {
+			return true
+		}
+		ls := bytes.Split(bs, this.split)
+		if index < 0 || index >= len(ls) {
+			//没有主键字段
+			o.ordered = false
+			return false
+		}
+		id := conv.Int64(string(ls[index]))
+		if !first && id <= o.max {
+			o.ordered = false
+		}
+		if first || id > o.max {
+			o.max = id
+		}
+		first = false
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	this.orders.Store(tableName, o)
+	return o, nil
+}
+
+// ordered 表的主键是否递增,出错时视为无序
+func (this *DB) ordered(tableName string) bool {
+	o, err := this.tableOrder(tableName)
+	return err == nil && o.ordered
+}
+
+// keepOrder 写入前主键有序时返回更新缓存的函数,写入后仍然有序(新的主键更大,修改不改变主键)
+func (this *DB) keepOrder(tableName string) func() {
+	filename := this.filename(tableName)
+	info, err := os.Stat(filename)
+	if err != nil {
+		return func() {}
+	}
+	v, ok := this.orders.Load(tableName)
+	if !ok || !v.(*order).fresh(info) || !v.(*order).ordered {
+		return func() {}
+	}
+	max := v.(*order).max
+	return func() {
+		if info, err := os.Stat(filename); err == nil {
+			this.orders.Store(tableName, &order{info: info, ordered: true, max: max})
+		}
+	}
+}
+
+// seedID 第一次插入前,按表中最大的主键设置lastID
+func (this *DB) seedID(tableName string) error {
+	if _, ok := this.seeded.Load(tableName); ok {
+		return nil
+	}
+	o, err := this.tableOrder(tableName)
+	if err != nil {
+		return err
+	}
+	this.mu.Lock()
+	if o.max > this.lastID {
+		this.lastID = o.max
+	}
+	this.mu.Unlock()
+	this.seeded.Store(tableName, true)
+	return nil
+}
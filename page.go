@@ -0,0 +1,38 @@
+package minidb
+
+import (
+	"errors"
+)
+
+// Page 分页信息
+type Page struct {
+	PageNo   int   `json:"pageNo"`   //页码,从1开始
+	PageSize int   `json:"pageSize"` //每页数量
+	Total    int64 `json:"total"`    //符合条件的总数量
+	Pages    int   `json:"pages"`    //总页数
+	HasNext  bool  `json:"hasNext"`  //是否有下一页
+}
+
+// Page 分页查询,查找第pageNo页的数据,并统计总数量,只遍历一次文件
+// 例 Page(&list, 2, 10) ,页码小于1时为第1页
+func (this *Action) Page(i interface{}, pageNo, pageSize int) (page Page, err error) {
+	defer this.dealErr(&err)
+	if pageSize <= 0 {
+		return page, errors.New("每页数量需要大于0")
+	}
+	if pageNo < 1 {
+		pageNo = 1
+	}
+	if err := this.setTable(i); err != nil {
+		return page, err
+	}
+	page.PageNo, page.PageSize = pageNo, pageSize
+	this.Limit(pageSize, (pageNo-1)*pageSize)
+	this.total = &page.Total
+	if err := this.find(); err != nil {
+		return page, err
+	}
+	page.Pages = int((page.Total + int64(pageSize) - 1) / int64(pageSize))
+	page.HasNext = pageNo < page.Pages
+	return page, this.db.unmarshal(this.Result, i)
+}
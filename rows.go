@@ -0,0 +1,122 @@
+package minidb
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+)
+
+// Iterate 逐条遍历查询的结果,每条数据解析到新的bean中,不缓存全部结果,fn返回错误时停止遍历并返回该错误
+// 例 Iterate(new(Person), func(i int, bean interface{}) error { p := bean.(*Person) ... })
+func (this *Action) Iterate(bean interface{}, fn func(i int, bean interface{}) error) (err error) {
+	defer this.dealErr(&err)
+	t := reflect.TypeOf(bean)
+	if t == nil || t.Kind() != reflect.Ptr {
+		return errors.New("bean需要是指针")
+	}
+	if err := this.setTable(bean); err != nil {
+		return err
+	}
+	i := 0
+	return this.rangeResult(func(field map[string]*Field) (bool, error) {
+		v := reflect.New(t.Elem()).Interface()
+		if err := this.db.unmarshal(fieldString(field), v); err != nil {
+			return false, err
+		}
+		if err := fn(i, v); err != nil {
+			return false, err
+		}
+		i++
+		return true, nil
+	})
+}
+
+// Rows 查询结果的游标,逐条读取数据,使用完后需要调用Close,例:
+//
+//	rows, err := db.Where("age>?", 18).Rows(new(Person))
+//	defer rows.Close()
+//	for rows.Next() {
+//		p := new(Person)
+//		err = rows.Scan(p)
+//	}
+//	err = rows.Err()
+func (this *Action) Rows(bean interface{}) (*Rows, error) {
+	if err := this.setTable(bean); err != nil {
+		return nil, err
+	}
+	r := &Rows{
+		db:     this.db,
+		rows:   make(chan map[string]*Field),
+		closed: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go func() {
+		defer close(r.done)
+		err := this.rangeResult(func(field map[string]*Field) (bool, error) {
+			select {
+			case r.rows <- field:
+				return true, nil
+			case <-r.closed:
+				return false, nil
+			}
+		})
+		this.dealErr(&err)
+		r.err = err
+		close(r.rows)
+	}()
+	return r, nil
+}
+
+// Rows 查询结果的游标,读取数据时才从文件解析下一条
+type Rows struct {
+	db     *DB
+	rows   chan map[string]*Field //逐条读取的数据
+	closed chan struct{}          //关闭信号,停止读取文件
+	done   chan struct{}          //读取文件结束
+	once   sync.Once
+	field  map[string]*Field //当前数据
+	end    bool              //是否读取结束
+	err    error             //读取文件的错误
+}
+
+// Next 读取下一条数据,没有数据或者出错时返回false,并释放文件
+func (this *Rows) Next() bool {
+	field, ok := <-this.rows
+	this.field = field
+	this.end = !ok
+	return ok
+}
+
+// Scan 解析当前数据到ptr
+func (this *Rows) Scan(ptr interface{}) error {
+	if this.field == nil {
+		return errors.New("没有数据,需要先调用Next")
+	}
+	return this.db.unmarshal(fieldString(this.field), ptr)
+}
+
+// Err 读取过程中的错误,在Next返回false后调用
+func (this *Rows) Err() error {
+	if !this.end {
+		return nil
+	}
+	return this.err
+}
+
+// Close 停止读取并释放文件,可以重复调用
+func (this *Rows) Close() error {
+	this.once.Do(func() {
+		close(this.closed)
+		<-this.done
+	})
+	return nil
+}
+
+// fieldString 数据转成map[string]string,用于解析到用户的对象
+func fieldString(field map[string]*Field) map[string]string {
+	m := make(map[string]string)
+	for k, v := range field {
+		m[k] = v.Value
+	}
+	return m
+}
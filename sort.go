@@ -0,0 +1,266 @@
+package minidb
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"github.com/injoyai/minidb/core"
+	"os"
+	"sort"
+)
+
+// sortRow 待排序的数据,Index为扫描顺序,排序值相等时保持原顺序
+type sortRow struct {
+	Index int
+	Field map[string]*Field
+}
+
+// sortHeap 大顶堆,堆顶为当前排序最靠后的数据,用于取前N条
+type sortHeap struct {
+	rows []*sortRow
+	less func(a, b *sortRow) bool
+}
+
+func (this *sortHeap) Len() int           { return len(this.rows) }
+func (this *sortHeap) Less(i, j int) bool { return this.less(this.rows[j], this.rows[i]) }
+func (this *sortHeap) Swap(i, j int)      { this.rows[i], this.rows[j] = this.rows[j], this.rows[i] }
+func (this *sortHeap) Push(x interface{}) { this.rows = append(this.rows, x.(*sortRow)) }
+func (this *sortHeap) Pop() interface{} {
+	row := this.rows[len(this.rows)-1]
+	this.rows = this.rows[:len(this.rows)-1]
+	return row
+}
+
+// sortBy 增加排序条件,多次调用时,前面的排序值相等才比较后面的
+func (this *Action) sortBy(less func(i, j map[string]*Field) bool) *Action {
+	last := this.SortHandler
+	if last == nil {
+		this.SortHandler = less
+		return this
+	}
+	this.SortHandler = func(i, j map[string]*Field) bool {
+		if last(i, j) {
+			return true
+		}
+		if last(j, i) {
+			return false
+		}
+		return less(i, j)
+	}
+	return this
+}
+
+// checkSort 校验排序的字段,分组查询时为分组字段,count及聚合字段
+func (this *Action) checkSort(col string) func(t *Table) error {
+	return func(t *Table) error {
+		if !this.grouped() {
+			return checkCol(col)(t)
+		}
+		if col == aggCount || inCols(this.groups, col) {
+			return nil
+		}
+		for _, agg := range this.aggregates {
+			if agg.As == col {
+				return nil
+			}
+		}
+		return fmt.Errorf("排序字段(%s)不是分组字段或聚合字段", col)
+	}
+}
+
+// less 排序比较,排序值相等时按扫描顺序
+func (this *Action) less(a, b *sortRow) bool {
+	if this.SortHandler(a.Field, b.Field) {
+		return true
+	}
+	if this.SortHandler(b.Field, a.Field) {
+		return false
+	}
+	return a.Index < b.Index
+}
+
+// rangeSort 排序(分组)查询,排序后再分页
+// 设置了Limit时只保留前offset+size条数据(堆),超过内存上限时同下,
+// 否则数据超过内存上限(WithMemory)时,排序后写入临时文件,最后多路归并
+func (this *Action) rangeSort(fn func(field map[string]*Field) (bool, error)) error {
+	index := 0
+	emit := func(field map[string]*Field) (bool, error) {
+		//数据分页
+		in, next := this.paging(index)
+		index++
+		if !in {
+			return next || this.total != nil, nil
+		}
+		if ok, err := fn(field); err != nil || !ok {
+			return false, err
+		}
+		//统计总数量时遍历全部数据
+		return next || this.total != nil, nil
+	}
+	if this.SortHandler == nil {
+		return this.rangeRows(emit)
+	}
+	if this.limited && this.limit > 0 {
+		err := this.sortTop(this.offset+this.limit, emit)
+		if err != errSortMemory {
+			return err
+		}
+		//前offset+size条数据超过内存上限,改为外部排序,重新遍历
+		if this.total != nil {
+			*this.total = 0
+		}
+	}
+	return this.sortMerge(emit)
+}
+
+// errSortMemory 堆中的数据超过内存上限
+var errSortMemory = errors.New("排序数据超过内存上限")
+
+// sortTop 取排序后的前size条数据,堆中的数据超过内存上限时返回errSortMemory(分组查询除外)
+func (this *Action) sortTop(size int, emit func(field map[string]*Field) (bool, error)) error {
+	h := &sortHeap{less: this.less}
+	index, memory := 0, 0
+	err := this.rangeRows(func(field map[string]*Field) (bool, error) {
+		row := &sortRow{Index: index, Field: field}
+		index++
+		if h.Len() < size {
+			memory += fieldSize(field)
+			if memory > this.db.memory && !this.grouped() {
+				return false, errSortMemory
+			}
+			heap.Push(h, row)
+		} else if this.less(row, h.rows[0]) {
+			//比堆顶(当前第size条)靠前,替换掉堆顶
+			h.rows[0] = row
+			heap.Fix(h, 0)
+		}
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Slice(h.rows, func(i, j int) bool { return this.less(h.rows[i], h.rows[j]) })
+	for _, row := range h.rows {
+		if next, err := emit(row.Field); err != nil || !next {
+			return err
+		}
+	}
+	return nil
+}
+
+// sortMerge 外部排序,超过内存上限的数据分段排序后写入临时文件(表文件同目录),再多路归并
+func (this *Action) sortMerge(emit func(field map[string]*Field) (bool, error)) (err error) {
+	rows := []*sortRow(nil)
+	memory := 0
+	runs := []*core.File(nil)
+	defer func() {
+		for _, run := range runs {
+			os.Remove(run.Filename)
+		}
+	}()
+
+	err = this.rangeRows(func(field map[string]*Field) (bool, error) {
+		rows = append(rows, &sortRow{Index: len(rows), Field: field})
+		memory += fieldSize(field)
+		//分组的数据已经在内存中,且字段不在表头,不写入临时文件
+		if memory < this.db.memory || this.grouped() {
+			return true, nil
+		}
+		//超过内存上限,排序后写入临时文件
+		run, err := this.sortSpill(rows)
+		if err != nil {
+			return false, err
+		}
+		runs = append(runs, run)
+		rows, memory = nil, 0
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Slice(rows, func(i, j int) bool { return this.less(rows[i], rows[j]) })
+
+	//数据量未超过内存上限
+	if len(runs) == 0 {
+		for _, row := range rows {
+			if next, err := emit(row.Field); err != nil || !next {
+				return err
+			}
+		}
+		return nil
+	}
+
+	//多路归并,每一路为一个临时文件,剩余未写入文件的数据作为最后一路
+	//Index为第几路,排序值相等时靠前的路(先扫描到的数据)优先
+	nexts := make([]func() *sortRow, 0, len(runs)+1)
+	for i, run := range runs {
+		f, err := os.Open(run.Filename)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		s := run.NewScanner(f)
+		index := i
+		nexts = append(nexts, func() *sortRow {
+			if !s.Scan() {
+				return nil
+			}
+			return &sortRow{Index: index, Field: this.header().DecodeData2(s.Bytes(), this.db.split)}
+		})
+	}
+	nexts = append(nexts, func() *sortRow {
+		if len(rows) == 0 {
+			return nil
+		}
+		row := rows[0]
+		row.Index = len(nexts) - 1
+		rows = rows[1:]
+		return row
+	})
+
+	//小顶堆,堆顶为每一路中排序最靠前的数据
+	h := &sortHeap{less: func(a, b *sortRow) bool { return this.less(b, a) }}
+	for _, next := range nexts {
+		if row := next(); row != nil {
+			heap.Push(h, row)
+		}
+	}
+	for h.Len() > 0 {
+		row := h.rows[0]
+		if next, err := emit(row.Field); err != nil || !next {
+			return err
+		}
+		if next := nexts[row.Index](); next != nil {
+			h.rows[0] = next
+			heap.Fix(h, 0)
+		} else {
+			heap.Pop(h)
+		}
+	}
+	return nil
+}
+
+// sortSpill 排序后写入临时文件
+func (this *Action) sortSpill(rows []*sortRow) (*core.File, error) {
+	sort.Slice(rows, func(i, j int) bool { return this.less(rows[i], rows[j]) })
+	ls := make([][]byte, 0, len(rows))
+	for _, row := range rows {
+		m := make(map[string]interface{}, len(row.Field))
+		for k, v := range row.Field {
+			m[k] = v.Value
+		}
+		ls = append(ls, this.header().EncodeData(m, this.db.split))
+	}
+	run := core.NewFile(fmt.Sprintf("%s.%d.sort", this.scanner.Filename, this.db.getID()), 1<<16)
+	run.Split = this.scanner.Split
+	return run, run.Create(ls...)
+}
+
+// fieldSize 估算一行数据占用的内存
+func fieldSize(field map[string]*Field) int {
+	size := 0
+	for k, v := range field {
+		size += len(k) + len(v.Value) + 64
+	}
+	return size
+}
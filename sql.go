@@ -0,0 +1,609 @@
+package minidb
+
+import (
+	"errors"
+	"fmt"
+	"github.com/injoyai/conv"
+	"github.com/injoyai/minidb/core"
+	"os"
+	"strings"
+)
+
+/*
+SQL 简单的SQL语句,编译成Action执行,和Where,Cols,Limit等方法的行为一致
+	SELECT * | 字段 [AS 别名],聚合 FROM 表 [WHERE 条件] [GROUP BY 字段] [HAVING 条件] [ORDER BY 字段 [ASC|DESC]] [LIMIT 数量 [OFFSET 偏移]]
+	INSERT INTO 表 [(字段)] VALUES (值) [,(值)]
+	UPDATE 表 SET 字段=值 [,字段=值] WHERE 条件
+	DELETE FROM 表 WHERE 条件
+*/
+
+const (
+	sqlSelect = "select"
+	sqlInsert = "insert"
+	sqlUpdate = "update"
+	sqlDelete = "delete"
+)
+
+// statement 编译后的语句
+type statement struct {
+	Type    string                   //语句类型 select,insert,update,delete
+	Action  *Action                  //编译后的操作
+	Columns []string                 //select的字段,*时为空
+	Sources map[string]string        //select字段对应的表字段,例 name AS n
+	Values  []map[string]interface{} //insert的数据,update修改的字段
+}
+
+// Query 执行查询语句,值按字段类型转换成int64,float64,bool,string
+// 例 Query("SELECT name, age FROM Person WHERE age > ? ORDER BY time DESC LIMIT 10", 18)
+func (this *DB) Query(sql string, args ...interface{}) (result []map[string]interface{}, err error) {
+	stmt, err := this.prepare(sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	if stmt.Type != sqlSelect {
+		return nil, fmt.Errorf("Query只支持SELECT语句: %s", sql)
+	}
+	defer stmt.Action.dealErr(&err)
+	err = stmt.Action.rangeResult(func(field map[string]*Field) (bool, error) {
+		result = append(result, stmt.row(field))
+		return true, nil
+	})
+	return
+}
+
+// columns 查询结果的字段,*时为表头的字段,分组时为分组字段,count及聚合字段,需要在查询后调用
+func (this *statement) columns() []string {
+	if len(this.Columns) > 0 {
+		return this.Columns
+	}
+	a := this.Action
+	if a.grouped() {
+		ls := append([]string{}, a.groups...)
+		ls = append(ls, aggCount)
+		for _, agg := range a.aggregates {
+			ls = append(ls, agg.As)
+		}
+		return ls
+	}
+	ls := []string(nil)
+	if a.table != nil {
+		for _, field := range a.table.Fields {
+			ls = append(ls, field.Name)
+		}
+	}
+	return ls
+}
+
+// row 查询结果的一行数据,只保留选择的字段
+func (this *statement) row(field map[string]*Field) map[string]interface{} {
+	m := make(map[string]interface{})
+	if len(this.Columns) == 0 {
+		for k, v := range field {
+			m[k] = v.Val()
+		}
+		return m
+	}
+	for _, k := range this.Columns {
+		m[k] = field[this.source(k)].Val()
+	}
+	return m
+}
+
+// source 查询结果的字段对应的表字段,例 name AS n 中n对应name
+func (this *statement) source(col string) string {
+	if v, ok := this.Sources[col]; ok {
+		return v
+	}
+	return col
+}
+
+// Exec 执行INSERT,UPDATE,DELETE语句,返回插入,修改或删除的数量
+// 例 Exec("UPDATE Person SET age = ? WHERE name = ?", 18, "小米")
+func (this *DB) Exec(sql string, args ...interface{}) (int64, error) {
+	stmt, err := this.prepare(sql, args...)
+	if err != nil {
+		return 0, err
+	}
+	if stmt.Type == sqlSelect {
+		return 0, fmt.Errorf("Exec不支持SELECT语句: %s", sql)
+	}
+	return stmt.exec()
+}
+
+// exec 执行INSERT,UPDATE,DELETE语句
+func (this *statement) exec() (int64, error) {
+	switch this.Type {
+	case sqlInsert:
+		ls := make([]interface{}, len(this.Values))
+		for i, v := range this.Values {
+			ls[i] = v
+		}
+		if err := this.Action.Insert(ls...); err != nil {
+			return 0, err
+		}
+		return int64(len(ls)), nil
+	case sqlUpdate:
+		return this.Action.Update(this.Values[0])
+	case sqlDelete:
+		return this.Action.Delete()
+	default:
+		return 0, errors.New("Exec不支持SELECT语句")
+	}
+}
+
+// prepare 编译语句
+func (this *DB) prepare(sql string, args ...interface{}) (*statement, error) {
+	//去掉结尾的分号
+	sql = strings.TrimSuffix(strings.TrimSpace(sql), ";")
+	tokens, err := lex(sql)
+	if err != nil {
+		return nil, fmt.Errorf("语句(%s)解析失败: %v", sql, err)
+	}
+	p := &sqlParser{
+		src:    []rune(sql),
+		tokens: tokens,
+		args:   args,
+		stmt:   &statement{Action: this.NewAction()},
+	}
+	if err := p.parse(); err != nil {
+		return nil, fmt.Errorf("语句(%s)解析失败: %v", sql, err)
+	}
+	if p.offset < len(args) {
+		return nil, fmt.Errorf("语句(%s)解析失败: 参数数量(%d)多于使用的数量(%d)", sql, len(args), p.offset)
+	}
+	if p.stmt.Action.Err != nil {
+		return nil, p.stmt.Action.Err
+	}
+	return p.stmt, nil
+}
+
+// sqlParser SQL语句解析,条件部分交给Where和Having解析
+type sqlParser struct {
+	src    []rune
+	tokens []token
+	pos    int
+	args   []interface{}
+	offset int //已使用的参数数量
+	stmt   *statement
+}
+
+func (this *sqlParser) peek() token {
+	return this.tokens[this.pos]
+}
+
+func (this *sqlParser) next() token {
+	t := this.peek()
+	if t.Type != tokenEOF {
+		this.pos++
+	}
+	return t
+}
+
+// expect 下一个必须是关键字
+func (this *sqlParser) expect(keywords ...string) error {
+	for _, keyword := range keywords {
+		if t := this.next(); !t.is(keyword) {
+			return fmt.Errorf("位置(%d)应为%s,得到(%s)", t.Pos, strings.ToUpper(keyword), t.Value)
+		}
+	}
+	return nil
+}
+
+// isClause 当前是否是子句的开始,例 WHERE , GROUP BY
+func (this *sqlParser) isClause(clauses ...string) bool {
+	t := this.peek()
+	for _, clause := range clauses {
+		switch clause {
+		case "group", "order":
+			if t.is(clause) && this.pos+1 < len(this.tokens) && this.tokens[this.pos+1].is("by") {
+				return true
+			}
+		default:
+			if t.is(clause) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// clause 取到下一个子句(括号外)之前的语句及使用的参数
+func (this *sqlParser) clause(clauses ...string) (string, []interface{}) {
+	start := this.peek()
+	depth, count := 0, 0
+	for t := this.peek(); t.Type != tokenEOF; t = this.peek() {
+		switch {
+		case t.Type == tokenLeft:
+			depth++
+		case t.Type == tokenRight:
+			depth--
+		case t.Type == tokenArg:
+			count++
+		case depth == 0 && this.isClause(clauses...):
+			return this.take(start, count)
+		}
+		this.next()
+	}
+	return this.take(start, count)
+}
+
+func (this *sqlParser) take(start token, count int) (string, []interface{}) {
+	s := strings.TrimSpace(string(this.src[start.Pos:this.peek().Pos]))
+	args := []interface{}(nil)
+	if this.offset+count <= len(this.args) {
+		args = this.args[this.offset : this.offset+count]
+	} else if this.offset < len(this.args) {
+		args = this.args[this.offset:]
+	}
+	this.offset += count
+	return s, args
+}
+
+// value 值,?按顺序取参数,NULL为空
+func (this *sqlParser) value() (interface{}, error) {
+	t := this.next()
+	switch t.Type {
+	case tokenArg:
+		if this.offset >= len(this.args) {
+			return nil, fmt.Errorf("缺少参数,位置(%d)", t.Pos)
+		}
+		this.offset++
+		return this.args[this.offset-1], nil
+	case tokenString:
+		return t.Value, nil
+	case tokenWord:
+		if t.is("null") {
+			return "", nil
+		}
+		return t.Value, nil
+	default:
+		return nil, fmt.Errorf("位置(%d)缺少值", t.Pos)
+	}
+}
+
+// name 表名或字段名
+func (this *sqlParser) name() (string, error) {
+	t := this.next()
+	if t.Type != tokenWord {
+		return "", fmt.Errorf("位置(%d)缺少名称", t.Pos)
+	}
+	return t.Value, nil
+}
+
+// names 括号包裹的名称列表,例 (name, age)
+func (this *sqlParser) names() ([]string, error) {
+	if t := this.next(); t.Type != tokenLeft {
+		return nil, fmt.Errorf("位置(%d)缺少左括号", t.Pos)
+	}
+	ls := []string(nil)
+	for {
+		name, err := this.name()
+		if err != nil {
+			return nil, err
+		}
+		ls = append(ls, name)
+		switch t := this.next(); t.Type {
+		case tokenComma:
+		case tokenRight:
+			return ls, nil
+		default:
+			return nil, fmt.Errorf("位置(%d)缺少右括号", t.Pos)
+		}
+	}
+}
+
+// values 括号包裹的值列表,例 (?, '小米', 18)
+func (this *sqlParser) values() ([]interface{}, error) {
+	if t := this.next(); t.Type != tokenLeft {
+		return nil, fmt.Errorf("位置(%d)缺少左括号", t.Pos)
+	}
+	ls := []interface{}(nil)
+	for {
+		value, err := this.value()
+		if err != nil {
+			return nil, err
+		}
+		ls = append(ls, value)
+		switch t := this.next(); t.Type {
+		case tokenComma:
+		case tokenRight:
+			return ls, nil
+		default:
+			return nil, fmt.Errorf("位置(%d)缺少右括号", t.Pos)
+		}
+	}
+}
+
+func (this *sqlParser) parse() error {
+	t := this.next()
+	switch {
+	case t.is(sqlSelect):
+		this.stmt.Type = sqlSelect
+		return this.parseSelect()
+	case t.is(sqlInsert):
+		this.stmt.Type = sqlInsert
+		return this.parseInsert()
+	case t.is(sqlUpdate):
+		this.stmt.Type = sqlUpdate
+		return this.parseUpdate()
+	case t.is(sqlDelete):
+		this.stmt.Type = sqlDelete
+		return this.parseDelete()
+	default:
+		return fmt.Errorf("未知的语句(%s)", t.Value)
+	}
+}
+
+// parseSelect SELECT 字段 FROM 表 [WHERE] [GROUP BY] [HAVING] [ORDER BY] [LIMIT]
+func (this *sqlParser) parseSelect() error {
+	a := this.stmt.Action
+
+	//字段,例 name, age, count(*) as total
+	//聚合字段交给Cols,其他字段在结果中筛选,排序和条件可以使用未选择的字段
+	if this.peek().Type == tokenWord && this.peek().Value == "*" {
+		this.next()
+	} else {
+		s, _ := this.clause("from")
+		for _, v := range splitTop(s) {
+			v = strings.TrimSpace(v)
+			if agg := parseAggregate(v); agg != nil {
+				a.Cols(v)
+				this.stmt.Columns = append(this.stmt.Columns, agg.As)
+				continue
+			}
+			//普通字段,例 name , name AS n
+			ls := strings.Fields(v)
+			switch {
+			case len(ls) == 1:
+			case len(ls) == 3 && strings.EqualFold(ls[1], "as"):
+				if this.stmt.Sources == nil {
+					this.stmt.Sources = make(map[string]string)
+				}
+				this.stmt.Sources[ls[2]] = ls[0]
+			default:
+				return fmt.Errorf("字段(%s)格式错误,例 name AS n", v)
+			}
+			a.checks = append(a.checks, checkCol(ls[0]))
+			this.stmt.Columns = append(this.stmt.Columns, ls[len(ls)-1])
+		}
+		if len(this.stmt.Columns) == 0 {
+			return errors.New("缺少字段")
+		}
+	}
+
+	if err := this.expect("from"); err != nil {
+		return err
+	}
+	table, err := this.name()
+	if err != nil {
+		return err
+	}
+	a.Table(table)
+
+	if this.peek().is("where") {
+		this.next()
+		s, args := this.clause("group", "having", "order", "limit")
+		a.Where(s, args...)
+	}
+
+	if this.isClause("group") {
+		this.next()
+		this.next()
+		s, _ := this.clause("having", "order", "limit")
+		a.GroupBy(s)
+	}
+
+	if this.peek().is("having") {
+		this.next()
+		s, args := this.clause("order", "limit")
+		a.Having(s, args...)
+	}
+
+	if this.isClause("order") {
+		this.next()
+		this.next()
+		for {
+			name, err := this.name()
+			if err != nil {
+				return err
+			}
+			switch {
+			case this.peek().is("desc"):
+				this.next()
+				a.Desc(name)
+			case this.peek().is("asc"):
+				this.next()
+				a.Asc(name)
+			default:
+				a.Asc(name)
+			}
+			if this.peek().Type != tokenComma {
+				break
+			}
+			this.next()
+		}
+	}
+
+	if this.peek().is("limit") {
+		this.next()
+		size, err := this.value()
+		if err != nil {
+			return err
+		}
+		switch {
+		case this.peek().Type == tokenComma:
+			//LIMIT 偏移, 数量
+			this.next()
+			offset := size
+			if size, err = this.value(); err != nil {
+				return err
+			}
+			a.Limit(conv.Int(size), conv.Int(offset))
+		case this.peek().is("offset"):
+			this.next()
+			offset, err := this.value()
+			if err != nil {
+				return err
+			}
+			a.Limit(conv.Int(size), conv.Int(offset))
+		default:
+			a.Limit(conv.Int(size))
+		}
+	}
+
+	return this.end()
+}
+
+// parseInsert INSERT INTO 表 [(字段)] VALUES (值) [,(值)]
+func (this *sqlParser) parseInsert() error {
+	if err := this.expect("into"); err != nil {
+		return err
+	}
+	table, err := this.name()
+	if err != nil {
+		return err
+	}
+	this.stmt.Action.Table(table)
+
+	cols := []string(nil)
+	if this.peek().Type == tokenLeft {
+		if cols, err = this.names(); err != nil {
+			return err
+		}
+	}
+
+	if err := this.expect("values"); err != nil {
+		return err
+	}
+	for {
+		values, err := this.values()
+		if err != nil {
+			return err
+		}
+		if cols == nil {
+			//未设置字段时,按表头顺序(不包括主键)
+			if cols, err = this.tableCols(); err != nil {
+				return err
+			}
+		}
+		if len(values) != len(cols) {
+			return fmt.Errorf("字段数量(%d)和值数量(%d)不一致", len(cols), len(values))
+		}
+		m := make(map[string]interface{})
+		for i, col := range cols {
+			m[col] = values[i]
+		}
+		this.stmt.Values = append(this.stmt.Values, m)
+		if this.peek().Type != tokenComma {
+			break
+		}
+		this.next()
+	}
+	return this.end()
+}
+
+// parseUpdate UPDATE 表 SET 字段=值 [,字段=值] WHERE 条件
+func (this *sqlParser) parseUpdate() error {
+	a := this.stmt.Action
+	table, err := this.name()
+	if err != nil {
+		return err
+	}
+	a.Table(table)
+
+	if err := this.expect("set"); err != nil {
+		return err
+	}
+	m := make(map[string]interface{})
+	for {
+		name, err := this.name()
+		if err != nil {
+			return err
+		}
+		if t := this.next(); t.Type != tokenOp || t.Value != "=" {
+			return fmt.Errorf("位置(%d)应为=,得到(%s)", t.Pos, t.Value)
+		}
+		value, err := this.value()
+		if err != nil {
+			return err
+		}
+		m[name] = value
+		if this.peek().Type != tokenComma {
+			break
+		}
+		this.next()
+	}
+	this.stmt.Values = append(this.stmt.Values, m)
+
+	if this.peek().is("where") {
+		this.next()
+		s, args := this.clause()
+		a.Where(s, args...)
+	}
+	return this.end()
+}
+
+// parseDelete DELETE FROM 表 WHERE 条件
+func (this *sqlParser) parseDelete() error {
+	if err := this.expect("from"); err != nil {
+		return err
+	}
+	table, err := this.name()
+	if err != nil {
+		return err
+	}
+	this.stmt.Action.Table(table)
+
+	if this.peek().is("where") {
+		this.next()
+		s, args := this.clause()
+		this.stmt.Action.Where(s, args...)
+	}
+	return this.end()
+}
+
+func (this *sqlParser) end() error {
+	if t := this.peek(); t.Type != tokenEOF {
+		return fmt.Errorf("位置(%d)未知的(%s)", t.Pos, t.Value)
+	}
+	return nil
+}
+
+// tableCols 表头中的字段,不包括主键
+func (this *sqlParser) tableCols() ([]string, error) {
+	a := this.stmt.Action
+	if err := a.scanner.WithScanner(func(f *os.File, p [][]byte, s *core.Scanner) error { return nil }); err != nil {
+		a.dealErr(&err)
+		return nil, err
+	}
+	cols := []string(nil)
+	for _, field := range a.table.Fields {
+		if field.Name != a.db.id {
+			cols = append(cols, field.Name)
+		}
+	}
+	return cols, nil
+}
+
+// splitTop 按括号外的逗号分割,例 name, count(*) as total
+func splitTop(s string) []string {
+	ls := []string(nil)
+	depth, start := 0, 0
+	for i, r := range s {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				ls = append(ls, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if strings.TrimSpace(s[start:]) != "" {
+		ls = append(ls, s[start:])
+	}
+	return ls
+}
@@ -0,0 +1,86 @@
+package minidb
+
+import (
+	"errors"
+	"github.com/injoyai/conv"
+)
+
+/*
+子查询,Action作为Where的参数,例:
+
+	online := db.Table("Device").Where("online=?", true).Cols("time")
+	db.Where("device_id in ?", online).Find(&logs)
+	db.Where("exists ?", online).Find(&logs)
+
+子查询只执行一次,结果缓存在条件中
+*/
+
+// condInQuery 值在子查询的结果中,例 device_id in ?
+type condInQuery struct {
+	Left   expr    //左边的表达式
+	Query  *Action //子查询,只能查询一个字段
+	values []string
+	set    map[string]bool //子查询结果,按左边值的类型转换
+	err    error
+}
+
+func (this *condInQuery) mate(field map[string]*Field) (bool, error) {
+	val, err := this.Left.eval(field)
+	if err != nil {
+		return false, err
+	}
+	if this.set == nil && this.err == nil {
+		this.values, this.err = this.Query.subquery()
+		this.set = make(map[string]bool, len(this.values))
+		for _, v := range this.values {
+			this.set[conv.String((&Field{Type: val.Type, Value: v}).Val())] = true
+		}
+	}
+	if this.err != nil {
+		return false, this.err
+	}
+	return this.set[conv.String(val.Val())], nil
+}
+
+func (this *condInQuery) keys() []string { return this.Left.keys() }
+
+// condExists 子查询是否有数据,例 exists ?
+type condExists struct {
+	Query *Action
+	has   *bool
+	err   error
+}
+
+func (this *condExists) mate(field map[string]*Field) (bool, error) {
+	if this.has == nil && this.err == nil {
+		has, err := this.Query.Exist()
+		this.has, this.err = &has, err
+	}
+	if this.err != nil {
+		return false, this.err
+	}
+	return *this.has, nil
+}
+
+func (this *condExists) keys() []string { return nil }
+
+// subquery 执行子查询,每条数据只能有一个字段
+func (this *Action) subquery() (ls []string, err error) {
+	defer this.dealErr(&err)
+	if err := this.setTable(); err != nil {
+		return nil, err
+	}
+	if len(this.TableName) == 0 {
+		return nil, errors.New("子查询未设置表名")
+	}
+	err = this.rangeResult(func(field map[string]*Field) (bool, error) {
+		if len(field) != 1 {
+			return false, errors.New("子查询只能查询一个字段,例 Cols(\"time\")")
+		}
+		for _, v := range field {
+			ls = append(ls, v.Value)
+		}
+		return true, nil
+	})
+	return
+}
@@ -0,0 +1,672 @@
+package minidb
+
+import (
+	"fmt"
+	"github.com/injoyai/conv"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+/*
+Where 条件解析
+支持 and , or , not 及括号,例:
+	(age>? and high<180) or name=小米
+	not (boy=true or age<=?)
+	id in (?) and age not between ? and ?
+	name like '小%' and name not regexp '^小.$'
+	used > quota or end_time - start_time > ?
+	device_id in ? or not exists ? ,参数为子查询(Action)
+参数?按顺序绑定,比较符右边未加引号的词,存在该字段时为字段,否则为值
+*/
+
+// cond 条件,判断一行数据是否符合
+type cond interface {
+	mate(field map[string]*Field) (bool, error)
+	keys() []string //条件中使用的字段,用于校验字段是否存在
+}
+
+// condAnd 全部符合
+type condAnd []cond
+
+func (this condAnd) mate(field map[string]*Field) (bool, error) {
+	for _, c := range this {
+		if mate, err := c.mate(field); err != nil || !mate {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func (this condAnd) keys() (ls []string) {
+	for _, c := range this {
+		ls = append(ls, c.keys()...)
+	}
+	return
+}
+
+// condOr 任意一个符合
+type condOr []cond
+
+func (this condOr) mate(field map[string]*Field) (bool, error) {
+	for _, c := range this {
+		if mate, err := c.mate(field); err != nil || mate {
+			return mate, err
+		}
+	}
+	return false, nil
+}
+
+func (this condOr) keys() (ls []string) {
+	for _, c := range this {
+		ls = append(ls, c.keys()...)
+	}
+	return
+}
+
+// condNot 取反
+type condNot struct {
+	cond
+}
+
+func (this condNot) mate(field map[string]*Field) (bool, error) {
+	mate, err := this.cond.mate(field)
+	return !mate && err == nil, err
+}
+
+// condCompare 比较,例 age>18 , used>quota , end_time - start_time > ?
+type condCompare struct {
+	Left  expr   //左边的表达式
+	Type  string //比较类型
+	Right expr   //右边的表达式
+}
+
+func (this *condCompare) mate(field map[string]*Field) (bool, error) {
+	left, err := this.Left.eval(field)
+	if err != nil {
+		return false, err
+	}
+	right, err := this.Right.eval(field)
+	if err != nil {
+		return false, err
+	}
+	return compareExpr(left, this.Type, right), nil
+}
+
+func (this *condCompare) keys() []string {
+	return append(this.Left.keys(), this.Right.keys()...)
+}
+
+// condIn 值在列表中,例 id in (1,2,3)
+type condIn struct {
+	Left   expr     //左边的表达式
+	Values []string //值列表
+}
+
+func (this *condIn) mate(field map[string]*Field) (bool, error) {
+	val, err := this.Left.eval(field)
+	if err != nil {
+		return false, err
+	}
+	for _, v := range this.Values {
+		if val.compare("=", v) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (this *condIn) keys() []string { return this.Left.keys() }
+
+// condBetween 值在区间内(包含两端),例 age between 18 and 20
+type condBetween struct {
+	Left  expr   //左边的表达式
+	Start string //开始的值
+	End   string //结束的值
+}
+
+func (this *condBetween) mate(field map[string]*Field) (bool, error) {
+	val, err := this.Left.eval(field)
+	if err != nil {
+		return false, err
+	}
+	return val.compare(">=", this.Start) && val.compare("<=", this.End), nil
+}
+
+func (this *condBetween) keys() []string { return this.Left.keys() }
+
+// checkKeys 校验条件(表达式)中的字段是否都在表头中
+func checkKeys(c interface{ keys() []string }, t *Table) error {
+	mField := t.Fields.Map()
+	for _, key := range c.keys() {
+		if _, ok := mField[key]; !ok {
+			return fmt.Errorf("字段(%s)不存在", key)
+		}
+	}
+	return nil
+}
+
+/*
+
+
+
+ */
+
+const (
+	tokenEOF    = iota
+	tokenWord   //字段或者未加引号的值,例 name , 小米 , 18
+	tokenString //加了引号的值,例 '小米'
+	tokenArg    //参数 ?
+	tokenOp     //比较符 = != <> > >= < <=
+	tokenLeft   //左括号
+	tokenRight  //右括号
+	tokenComma  //逗号
+)
+
+type token struct {
+	Type  int
+	Value string
+	Pos   int //在原字符串中的位置,用于错误提示
+}
+
+// is 是否是关键字,不区分大小写
+func (this token) is(keyword string) bool {
+	return this.Type == tokenWord && strings.EqualFold(this.Value, keyword)
+}
+
+// isCalc 是否是运算符,需要用空格隔开
+func (this token) isCalc(ops string) bool {
+	return this.Type == tokenWord && len(this.Value) == 1 && strings.Contains(ops, this.Value)
+}
+
+// lex 分词
+func lex(s string) ([]token, error) {
+	ls := []token(nil)
+	rs := []rune(s)
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+
+		case r == '(':
+			ls = append(ls, token{Type: tokenLeft, Value: "(", Pos: i})
+			i++
+
+		case r == ')':
+			ls = append(ls, token{Type: tokenRight, Value: ")", Pos: i})
+			i++
+
+		case r == ',':
+			ls = append(ls, token{Type: tokenComma, Value: ",", Pos: i})
+			i++
+
+		case r == '?':
+			ls = append(ls, token{Type: tokenArg, Value: "?", Pos: i})
+			i++
+
+		case r == '=':
+			ls = append(ls, token{Type: tokenOp, Value: "=", Pos: i})
+			i++
+
+		case r == '!', r == '<', r == '>':
+			op := string(r)
+			if i+1 < len(rs) && (rs[i+1] == '=' || (r == '<' && rs[i+1] == '>')) {
+				op += string(rs[i+1])
+			}
+			if op == "!" {
+				return nil, fmt.Errorf("未知的比较符(!),位置(%d)", i)
+			}
+			ls = append(ls, token{Type: tokenOp, Value: op, Pos: i})
+			i += len(op)
+
+		case r == '\'', r == '"':
+			//引号包裹的值,两个连续的引号表示引号本身
+			start := i
+			value := []rune(nil)
+			for i++; ; i++ {
+				if i >= len(rs) {
+					return nil, fmt.Errorf("引号未闭合,位置(%d)", start)
+				}
+				if rs[i] == r {
+					if i+1 < len(rs) && rs[i+1] == r {
+						value = append(value, r)
+						i++
+						continue
+					}
+					i++
+					break
+				}
+				value = append(value, rs[i])
+			}
+			ls = append(ls, token{Type: tokenString, Value: string(value), Pos: start})
+
+		default:
+			start := i
+			for i < len(rs) && !unicode.IsSpace(rs[i]) && !strings.ContainsRune("()=!<>,?'\"", rs[i]) {
+				i++
+			}
+			ls = append(ls, token{Type: tokenWord, Value: string(rs[start:i]), Pos: start})
+
+		}
+	}
+	ls = append(ls, token{Type: tokenEOF, Pos: len(rs)})
+	return ls, nil
+}
+
+// parseWhere 解析条件语句,例 (age>? and high<180) or name=小米
+// 无法解析的语句,缺少或者多余的参数都会返回错误,cache为like和regexp的编译缓存
+func parseWhere(cache patterns, s string, args ...interface{}) (cond, error) {
+	if cache == nil {
+		cache = patterns{}
+	}
+	tokens, err := lex(s)
+	if err != nil {
+		return nil, fmt.Errorf("条件(%s)解析失败: %v", s, err)
+	}
+	p := &parser{tokens: tokens, args: args, patterns: cache}
+	c, err := p.parseOr()
+	if err != nil {
+		return nil, fmt.Errorf("条件(%s)解析失败: %v", s, err)
+	}
+	if t := p.peek(); t.Type != tokenEOF {
+		return nil, fmt.Errorf("条件(%s)解析失败: 位置(%d)未知的(%s)", s, t.Pos, t.Value)
+	}
+	if p.offset < len(args) {
+		return nil, fmt.Errorf("条件(%s)解析失败: 参数数量(%d)多于使用的数量(%d)", s, len(args), p.offset)
+	}
+	return c, nil
+}
+
+// parseSet 解析修改的表达式,例 total + ? ,未加引号的词为字段,数字除外
+func parseSet(s string, args ...interface{}) (expr, error) {
+	tokens, err := lex(s)
+	if err != nil {
+		return nil, fmt.Errorf("表达式(%s)解析失败: %v", s, err)
+	}
+	p := &parser{tokens: tokens, args: args, patterns: patterns{}}
+	e, err := p.parseExpr(true)
+	if err != nil {
+		return nil, fmt.Errorf("表达式(%s)解析失败: %v", s, err)
+	}
+	if t := p.peek(); t.Type != tokenEOF {
+		return nil, fmt.Errorf("表达式(%s)解析失败: 位置(%d)未知的(%s)", s, t.Pos, t.Value)
+	}
+	if p.offset < len(args) {
+		return nil, fmt.Errorf("表达式(%s)解析失败: 参数数量(%d)多于使用的数量(%d)", s, len(args), p.offset)
+	}
+	return e, nil
+}
+
+// parser 条件解析,优先级 not > and > or
+type parser struct {
+	tokens   []token
+	pos      int
+	args     []interface{}
+	offset   int      //已使用的参数数量
+	patterns patterns //like和regexp的编译缓存
+}
+
+func (this *parser) peek() token {
+	if this.pos < len(this.tokens) {
+		return this.tokens[this.pos]
+	}
+	return token{Type: tokenEOF}
+}
+
+func (this *parser) next() token {
+	t := this.peek()
+	if t.Type != tokenEOF {
+		this.pos++
+	}
+	return t
+}
+
+func (this *parser) parseOr() (cond, error) {
+	c, err := this.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	or := condOr{c}
+	for this.peek().is("or") {
+		this.next()
+		c, err := this.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		or = append(or, c)
+	}
+	if len(or) == 1 {
+		return or[0], nil
+	}
+	return or, nil
+}
+
+func (this *parser) parseAnd() (cond, error) {
+	c, err := this.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	and := condAnd{c}
+	for this.peek().is("and") {
+		this.next()
+		c, err := this.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		and = append(and, c)
+	}
+	if len(and) == 1 {
+		return and[0], nil
+	}
+	return and, nil
+}
+
+func (this *parser) parseNot() (cond, error) {
+	if this.peek().is("not") {
+		this.next()
+		c, err := this.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return condNot{c}, nil
+	}
+	return this.parsePrimary()
+}
+
+func (this *parser) parsePrimary() (cond, error) {
+	t := this.peek()
+	switch t.Type {
+	case tokenLeft:
+		//括号可能是条件,也可能是运算,例 (a>1 or b<2) , (a + b) > 1
+		pos, offset := this.pos, this.offset
+		this.next()
+		c, err := this.parseOr()
+		if err == nil {
+			if t := this.next(); t.Type != tokenRight {
+				return nil, fmt.Errorf("缺少右括号,位置(%d)", t.Pos)
+			}
+			return c, nil
+		}
+		this.pos, this.offset = pos, offset
+		if c, err2 := this.parseCompare(); err2 == nil {
+			return c, nil
+		}
+		return nil, err
+
+	case tokenWord, tokenString, tokenArg:
+		if t.is("exists") {
+			//子查询是否有数据,例 exists ?
+			this.next()
+			query, ok := this.parseQuery()
+			if !ok {
+				return nil, fmt.Errorf("exists需要子查询参数,位置(%d)", t.Pos)
+			}
+			return &condExists{Query: query}, nil
+		}
+		return this.parseCompare()
+
+	case tokenEOF:
+		return nil, fmt.Errorf("条件不完整,位置(%d)", t.Pos)
+
+	default:
+		return nil, fmt.Errorf("位置(%d)应为字段,得到(%s)", t.Pos, t.Value)
+
+	}
+}
+
+// parseCompare 解析比较,例 age>18 , name like '小%' , id in (1,2) , age not between 18 and 20 , used>quota
+func (this *parser) parseCompare() (cond, error) {
+	start := this.peek()
+	left, err := this.parseExpr(true)
+	if err != nil {
+		return nil, err
+	}
+	key := start.Value
+	if _, ok := left.(*exprCalc); ok || start.Type == tokenLeft {
+		key = fmt.Sprintf("位置(%d)的表达式", start.Pos)
+	}
+
+	not := false
+	if this.peek().is("not") {
+		this.next()
+		not = true
+	}
+	t := this.next()
+	var c cond
+	switch {
+	case t.Type == tokenOp && !not:
+		right, err := this.parseExpr(false)
+		if err != nil {
+			return nil, fmt.Errorf("字段(%s): %v", key, err)
+		}
+		c = &condCompare{Left: left, Type: t.Value, Right: right}
+
+	case t.is("like"), t.is("regexp"):
+		right, err := this.parseExpr(false)
+		if err != nil {
+			return nil, fmt.Errorf("字段(%s): %v", key, err)
+		}
+		c2 := &condMatch{Left: left, Right: right, Regexp: t.is("regexp"), Escape: '\\', patterns: this.patterns}
+		if !c2.Regexp && this.peek().is("escape") {
+			this.next()
+			escape, err := this.parseValue()
+			if err != nil {
+				return nil, fmt.Errorf("字段(%s): %v", key, err)
+			}
+			if len([]rune(escape)) != 1 {
+				return nil, fmt.Errorf("字段(%s): 转义字符(%s)只能是一个字符", key, escape)
+			}
+			c2.Escape = []rune(escape)[0]
+		}
+		//值的规则在解析时编译,错误的规则直接返回错误
+		if value, ok := right.(exprValue); ok {
+			if _, err := c2.compile(string(value)); err != nil {
+				return nil, fmt.Errorf("字段(%s): %v", key, err)
+			}
+		}
+		c = c2
+
+	case t.is("in"):
+		if query, ok := this.parseQuery(); ok {
+			c = &condInQuery{Left: left, Query: query}
+			break
+		}
+		values, err := this.parseValues()
+		if err != nil {
+			return nil, fmt.Errorf("字段(%s): %v", key, err)
+		}
+		c = &condIn{Left: left, Values: values}
+
+	case t.is("between"):
+		start, err := this.parseValue()
+		if err != nil {
+			return nil, fmt.Errorf("字段(%s): %v", key, err)
+		}
+		if t := this.next(); !t.is("and") {
+			return nil, fmt.Errorf("字段(%s): between缺少and,位置(%d)", key, t.Pos)
+		}
+		end, err := this.parseValue()
+		if err != nil {
+			return nil, fmt.Errorf("字段(%s): %v", key, err)
+		}
+		c = &condBetween{Left: left, Start: start, End: end}
+
+	case t.Type == tokenEOF:
+		return nil, fmt.Errorf("字段(%s)缺少比较符", key)
+
+	default:
+		return nil, fmt.Errorf("字段(%s)后未知的比较符(%s),位置(%d)", key, t.Value, t.Pos)
+
+	}
+	if not {
+		return condNot{c}, nil
+	}
+	return c, nil
+}
+
+// parseExpr 解析表达式,例 age , end_time - start_time , (used + 1) * 2
+// left为比较符左边,未加引号的词视为字段,右边的词存在该字段时为字段,否则为值
+func (this *parser) parseExpr(left bool) (expr, error) {
+	e, err := this.parseTerm(left)
+	if err != nil {
+		return nil, err
+	}
+	for this.peek().isCalc("+-") {
+		op := this.next().Value
+		right, err := this.parseTerm(left)
+		if err != nil {
+			return nil, err
+		}
+		e = newCalc(op, e, right)
+	}
+	return e, nil
+}
+
+func (this *parser) parseTerm(left bool) (expr, error) {
+	e, err := this.parseFactor(left)
+	if err != nil {
+		return nil, err
+	}
+	for this.peek().isCalc("*/") {
+		op := this.next().Value
+		right, err := this.parseFactor(left)
+		if err != nil {
+			return nil, err
+		}
+		e = newCalc(op, e, right)
+	}
+	return e, nil
+}
+
+func (this *parser) parseFactor(left bool) (expr, error) {
+	t := this.peek()
+	switch t.Type {
+	case tokenLeft:
+		this.next()
+		e, err := this.parseExpr(left)
+		if err != nil {
+			return nil, err
+		}
+		if t := this.next(); t.Type != tokenRight {
+			return nil, fmt.Errorf("缺少右括号,位置(%d)", t.Pos)
+		}
+		return e, nil
+
+	case tokenWord:
+		if t.isCalc("+-*/") || t.is("and") || t.is("or") || t.is("not") {
+			return nil, fmt.Errorf("位置(%d)缺少值", t.Pos)
+		}
+		this.next()
+		if left {
+			if _, err := strconv.ParseFloat(t.Value, 64); err == nil {
+				return exprValue(t.Value), nil
+			}
+			return exprField(t.Value), nil
+		}
+		return exprWord(t.Value), nil
+
+	default:
+		value, err := this.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		return exprValue(value), nil
+
+	}
+}
+
+// parseQuery 解析子查询参数,例 ? , (?) ,参数不是子查询时不解析
+func (this *parser) parseQuery() (*Action, bool) {
+	pos := this.pos
+	paren := this.peek().Type == tokenLeft
+	if paren {
+		this.next()
+	}
+	if this.peek().Type == tokenArg && this.offset < len(this.args) {
+		if query, ok := this.args[this.offset].(*Action); ok {
+			this.next()
+			if !paren || this.peek().Type == tokenRight {
+				if paren {
+					this.next()
+				}
+				this.offset++
+				return query, true
+			}
+		}
+	}
+	this.pos = pos
+	return nil, false
+}
+
+// parseValues 解析值列表,例 (1,2,?) ,参数为切片时展开
+func (this *parser) parseValues() ([]string, error) {
+	if this.peek().Type == tokenArg {
+		//in ? 参数需为切片
+		return this.parseArgs()
+	}
+	if t := this.next(); t.Type != tokenLeft {
+		return nil, fmt.Errorf("缺少左括号,位置(%d)", t.Pos)
+	}
+	ls := []string(nil)
+	for {
+		if this.peek().Type == tokenArg {
+			values, err := this.parseArgs()
+			if err != nil {
+				return nil, err
+			}
+			ls = append(ls, values...)
+		} else {
+			value, err := this.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			ls = append(ls, value)
+		}
+		switch t := this.next(); t.Type {
+		case tokenComma:
+		case tokenRight:
+			return ls, nil
+		default:
+			return nil, fmt.Errorf("缺少右括号,位置(%d)", t.Pos)
+		}
+	}
+}
+
+// parseArgs 取一个参数,切片则展开成多个值
+func (this *parser) parseArgs() ([]string, error) {
+	t := this.next()
+	if this.offset >= len(this.args) {
+		return nil, fmt.Errorf("缺少参数,位置(%d)", t.Pos)
+	}
+	arg := this.args[this.offset]
+	this.offset++
+	ls := []string(nil)
+	switch arg.(type) {
+	case string, []byte:
+		ls = append(ls, conv.String(arg))
+	default:
+		for _, v := range conv.Interfaces(arg) {
+			ls = append(ls, conv.String(v))
+		}
+	}
+	return ls, nil
+}
+
+// parseValue 解析值,?则按顺序取参数
+func (this *parser) parseValue() (string, error) {
+	t := this.next()
+	switch t.Type {
+	case tokenWord, tokenString:
+		return t.Value, nil
+	case tokenArg:
+		if this.offset >= len(this.args) {
+			return "", fmt.Errorf("缺少参数,位置(%d)", t.Pos)
+		}
+		value := this.args[this.offset]
+		this.offset++
+		return conv.String(value), nil
+	default:
+		return "", fmt.Errorf("缺少值,位置(%d)", t.Pos)
+	}
+}